@@ -0,0 +1,198 @@
+// Command dbmigrate applies and manages SQL migrations using goutils.DBConn.
+//
+// Usage:
+//
+//	dbmigrate [flags] up
+//	dbmigrate [flags] down [N | -all]
+//	dbmigrate [flags] goto VERSION
+//	dbmigrate [flags] version
+//	dbmigrate [flags] force VERSION
+//	dbmigrate [flags] create NAME
+//
+// The database is configured from, in increasing order of precedence, a YAML
+// or JSON file given by -config, DB_* environment variables (see
+// DatabaseConfig.LoadEnv) and flags.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	_ "github.com/RamanPndy/go-utils/utils/sqlite"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "dbmigrate:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("dbmigrate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: dbmigrate [flags] up | down [N | -all] | goto VERSION | version | force VERSION | create NAME")
+		flags.PrintDefaults()
+	}
+	configFile := flags.String("config", "", "YAML file holding the database configuration")
+	dbType := flags.String("type", "", "database type: postgres, mysql or sqlite3 (env DB_TYPE)")
+	address := flags.String("address", "", "database host (env DB_ADDRESS)")
+	port := flags.Int("port", 0, "database port (env DB_PORT)")
+	user := flags.String("user", "", "database user (env DB_USER)")
+	password := flags.String("password", "", "database password (env DB_PASSWORD)")
+	name := flags.String("name", "", "database name, or file for sqlite3 (env DB_NAME)")
+	ssl := flags.String("ssl", "", "SSL mode (env DB_SSL)")
+	dsn := flags.String("dsn", "", "full DSN, overrides the other connection settings (env DB_DSN)")
+	path := flags.String("path", "", "migrations directory (env DB_MIGRATIONS_PATH)")
+	verbose := flags.Bool("verbose", false, "log every applied migration")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing command")
+	}
+
+	config := &goutils.DatabaseConfig{}
+	if *configFile != "" {
+		if err := config.LoadFile(*configFile); err != nil {
+			return err
+		}
+	}
+	if err := config.LoadEnv(goutils.DefaultDatabaseEnvPrefix); err != nil {
+		return err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "type":
+			config.Type = *dbType
+		case "address":
+			config.Address = *address
+		case "port":
+			config.Port = *port
+		case "user":
+			config.User = *user
+		case "password":
+			config.Password = *password
+		case "name":
+			config.Name = *name
+		case "ssl":
+			config.SSL = *ssl
+		case "dsn":
+			config.DSN = *dsn
+		case "path":
+			config.MigrationsPath = *path
+		}
+	})
+	if config.MigrationsPath == "" {
+		config.MigrationsPath = goutils.DefaultMigrationsPath
+	}
+
+	command, cmdArgs := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "up", "down", "goto", "version", "force", "create":
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if command == "create" {
+		if len(cmdArgs) != 1 {
+			return errors.New("usage: create NAME")
+		}
+		up, down, err := goutils.CreateMigrationFiles(config.MigrationsPath, cmdArgs[0], time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Println(up)
+		fmt.Println(down)
+		return nil
+	}
+
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	if *verbose {
+		logger.SetLevel(logrus.InfoLevel)
+	}
+	conn, err := goutils.NewDBConn(config, logger)
+	if err != nil {
+		return err
+	}
+	m, err := conn.NewMigrator()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	// Serialize with replicas migrating at startup through MigrateWithLock.
+	withLock := func(fn func() error) error {
+		return conn.WithMigrationLock(context.Background(), goutils.MigrationLockOptions{}, fn)
+	}
+
+	switch command {
+	case "up":
+		return withLock(m.Up)
+	case "down":
+		downFlags := flag.NewFlagSet("down", flag.ContinueOnError)
+		all := downFlags.Bool("all", false, "roll back every applied migration")
+		if err := downFlags.Parse(cmdArgs); err != nil {
+			return err
+		}
+		steps := 1
+		switch {
+		case downFlags.NArg() > 1 || *all && downFlags.NArg() > 0:
+			return errors.New("usage: down [N | -all]")
+		case *all:
+			return withLock(m.DownAll)
+		case downFlags.NArg() == 1:
+			if steps, err = strconv.Atoi(downFlags.Arg(0)); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", downFlags.Arg(0))
+			}
+		}
+		return withLock(func() error { return m.Down(steps) })
+	case "goto":
+		if len(cmdArgs) != 1 {
+			return errors.New("usage: goto VERSION")
+		}
+		version, err := strconv.ParseUint(cmdArgs[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", cmdArgs[0])
+		}
+		return withLock(func() error { return m.Goto(uint(version)) })
+	case "force":
+		if len(cmdArgs) != 1 {
+			return errors.New("usage: force VERSION")
+		}
+		version, err := strconv.Atoi(cmdArgs[0])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", cmdArgs[0])
+		}
+		return withLock(func() error { return m.Force(version) })
+	default: // version
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+		switch {
+		case status.Dirty:
+			fmt.Printf("%d (dirty)\n", status.Version)
+		case len(status.Applied) == 0:
+			fmt.Println("no migration applied")
+		default:
+			fmt.Println(status.Version)
+		}
+		for _, info := range status.Pending {
+			fmt.Printf("pending: %d_%s\n", info.Version, info.Name)
+		}
+		return nil
+	}
+}
@@ -9,11 +9,15 @@ require github.com/golang/protobuf v1.5.4
 require (
 	github.com/dlmiddlecote/sqlstats v1.0.2
 	github.com/ghodss/yaml v1.0.0
+	github.com/go-sql-driver/mysql v1.5.0
 	github.com/golang-migrate/migrate/v4 v4.19.1
 	github.com/jinzhu/gorm v1.9.16
+	github.com/lib/pq v1.10.9
 	github.com/prometheus/client_golang v1.23.2
+	github.com/prometheus/client_model v0.6.2
 	github.com/sirupsen/logrus v1.9.4
 	google.golang.org/protobuf v1.36.8
+	gopkg.in/yaml.v2 v2.2.2
 )
 
 require (
@@ -21,12 +25,10 @@ require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/kr/text v0.2.0 // indirect
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/mattn/go-sqlite3 v1.14.22 // indirect
 	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
-	github.com/prometheus/client_model v0.6.2 // indirect
 	github.com/prometheus/common v0.66.1 // indirect
 	github.com/prometheus/procfs v0.16.1 // indirect
 	go.yaml.in/yaml/v2 v2.4.2 // indirect
 	golang.org/x/sys v0.38.0 // indirect
-	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
@@ -0,0 +1,121 @@
+package goutils_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+)
+
+type bulkProduct struct {
+	ID        uint
+	SKU       string `gorm:"unique_index"`
+	Name      string
+	Stock     int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func bulkProducts(n int) []bulkProduct {
+	products := make([]bulkProduct, n)
+	for i := range products {
+		products[i] = bulkProduct{SKU: fmt.Sprintf("sku-%05d", i), Name: fmt.Sprintf("Product %d", i), Stock: i}
+	}
+	return products
+}
+
+func TestBulkInsert(t *testing.T) {
+	tests := []struct {
+		name string
+		rows int
+		opts *goutils.BulkOptions
+	}{
+		{name: "Single statement", rows: 5},
+		{name: "Batches", rows: 7, opts: &goutils.BulkOptions{BatchSize: 2}},
+		// 10000 rows of 5 columns exceed the SQLite bind parameter limit.
+		{name: "Parameter limit", rows: 10000},
+		{name: "Copy disabled", rows: 3, opts: &goutils.BulkOptions{DisableCopy: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newSQLiteTestDB(t, &bulkProduct{})
+			rows := bulkProducts(tt.rows)
+			n, err := goutils.BulkInsert(context.Background(), db, rows, tt.opts)
+			if err != nil {
+				t.Fatalf("BulkInsert() error = %v", err)
+			}
+			if !rows[0].CreatedAt.IsZero() || !rows[0].UpdatedAt.IsZero() {
+				t.Errorf("expected the rows to be left unchanged, got %+v", rows[0])
+			}
+			if n != int64(tt.rows) {
+				t.Errorf("expected %d rows inserted, got %d", tt.rows, n)
+			}
+			var count int
+			db.Model(&bulkProduct{}).Count(&count)
+			if count != tt.rows {
+				t.Errorf("expected %d rows, got %d", tt.rows, count)
+			}
+			var last bulkProduct
+			db.Last(&last)
+			if last.CreatedAt.IsZero() || last.UpdatedAt.IsZero() || last.ID != uint(tt.rows) {
+				t.Errorf("expected ids and timestamps to be set, got %+v", last)
+			}
+		})
+	}
+}
+
+func TestBulkUpsert(t *testing.T) {
+	db := newSQLiteTestDB(t, &bulkProduct{})
+	ctx := context.Background()
+	if _, err := goutils.BulkInsert(ctx, db, bulkProducts(3), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := bulkProducts(5)
+	for i := range rows {
+		rows[i].Name = "Renamed"
+		rows[i].Stock = 100
+	}
+	if _, err := goutils.BulkUpsert(ctx, db, rows, []string{"sku"}, &goutils.BulkOptions{BatchSize: 2, UpdateColumns: []string{"Stock"}}); err != nil {
+		t.Fatalf("BulkUpsert() error = %v", err)
+	}
+
+	var products []bulkProduct
+	db.Order("id").Find(&products)
+	if len(products) != 5 {
+		t.Fatalf("expected 5 products, got %d", len(products))
+	}
+	for i, p := range products {
+		if p.Stock != 100 {
+			t.Errorf("product %d: expected stock 100, got %d", i, p.Stock)
+		}
+		expectedName := "Renamed"
+		if i < 3 {
+			expectedName = fmt.Sprintf("Product %d", i)
+		}
+		if p.Name != expectedName {
+			t.Errorf("product %d: expected name %q, got %q", i, expectedName, p.Name)
+		}
+	}
+
+	// By default all other columns are updated.
+	rows[0].Name = "Updated"
+	if _, err := goutils.BulkUpsert(ctx, db, rows[:1], []string{"sku"}, nil); err != nil {
+		t.Fatalf("BulkUpsert() error = %v", err)
+	}
+	var first bulkProduct
+	db.First(&first, 1)
+	if first.Name != "Updated" {
+		t.Errorf("expected the name to be updated, got %q", first.Name)
+	}
+
+	if _, err := goutils.BulkUpsert(ctx, db, rows, nil, nil); err == nil {
+		t.Error("expected an error without conflict columns")
+	}
+	if _, err := goutils.BulkUpsert(ctx, db, rows, []string{"barcode"}, nil); err == nil {
+		t.Error("expected an error for an unknown conflict column")
+	}
+}
@@ -0,0 +1,107 @@
+package goutils_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+)
+
+type credentialItem struct {
+	ID   uint
+	Name string
+}
+
+func TestCredentialSources(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	os.WriteFile(passwordFile, []byte("from-file\n"), 0o600)
+	dsnFile := filepath.Join(dir, "dsn")
+	os.WriteFile(dsnFile, []byte("host=db user=app password=dsn-file dbname=app\n"), 0o600)
+	t.Setenv("TEST_DB_PASSWORD", "from-env")
+	t.Setenv("TEST_DB_EMPTY", " ")
+	emptyFile := filepath.Join(dir, "empty")
+	os.WriteFile(emptyFile, []byte("\n"), 0o600)
+
+	base := goutils.DatabaseConfig{Type: goutils.POSTGRESQL, Address: "db", Port: 5432, User: "app", Password: "static", Name: "app"}
+	tests := []struct {
+		name     string
+		modify   func(c *goutils.DatabaseConfig)
+		expected string
+	}{
+		{name: "Static password", modify: func(c *goutils.DatabaseConfig) {}, expected: "password=static"},
+		{name: "Password file", modify: func(c *goutils.DatabaseConfig) { c.PasswordFile = passwordFile }, expected: "password=from-file"},
+		{name: "Password env", modify: func(c *goutils.DatabaseConfig) { c.PasswordEnv = "TEST_DB_PASSWORD" }, expected: "password=from-env"},
+		{name: "DSN file overrides DSN", modify: func(c *goutils.DatabaseConfig) { c.DSN = "host=other"; c.DSNFile = dsnFile }, expected: "password=dsn-file"},
+		{name: "Missing env", modify: func(c *goutils.DatabaseConfig) { c.PasswordEnv = "TEST_DB_MISSING" }, expected: ""},
+		{name: "Empty env", modify: func(c *goutils.DatabaseConfig) { c.DSNEnv = "TEST_DB_EMPTY" }, expected: ""},
+		{name: "Empty file", modify: func(c *goutils.DatabaseConfig) { c.PasswordFile = emptyFile }, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := base
+			tt.modify(&config)
+			conn, _ := goutils.NewDBConn(&config, newTestLogger())
+			dsn := conn.GetDSN()
+			if tt.expected == "" && dsn != "" {
+				t.Errorf("expected no DSN, got %q", dsn)
+			}
+			if !strings.Contains(dsn, tt.expected) {
+				t.Errorf("GetDSN() = %q, expected it to contain %q", dsn, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReloadCredentials(t *testing.T) {
+	dir := t.TempDir()
+	dsnFile := filepath.Join(dir, "dsn")
+	os.WriteFile(dsnFile, []byte(filepath.Join(dir, "first.db")), 0o600)
+
+	conn, _ := goutils.NewDBConn(&goutils.DatabaseConfig{Type: goutils.SQLITE3, DSNFile: dsnFile}, newTestLogger())
+	ctx := context.Background()
+	if _, err := conn.ReloadCredentials(ctx); err == nil {
+		t.Errorf("expected error before Connect")
+	}
+	first, err := conn.Connect()
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	first.AutoMigrate(&credentialItem{})
+
+	if rotated, err := conn.ReloadCredentials(ctx); rotated || err != nil {
+		t.Errorf("expected no rotation without changes, got %v, %v", rotated, err)
+	}
+
+	// In-flight work must survive the rotation.
+	tx := first.Begin()
+	tx.Create(&credentialItem{Name: "in flight"})
+
+	os.WriteFile(dsnFile, []byte(filepath.Join(dir, "missing", "second.db")), 0o600)
+	if rotated, err := conn.ReloadCredentials(ctx); rotated || err == nil {
+		t.Errorf("expected invalid credentials to be rejected, got %v, %v", rotated, err)
+	}
+
+	os.WriteFile(dsnFile, []byte(filepath.Join(dir, "second.db")), 0o600)
+	rotated, err := conn.ReloadCredentials(ctx)
+	if !rotated || err != nil {
+		t.Fatalf("expected rotation, got %v, %v", rotated, err)
+	}
+	if conn.DB() != first {
+		t.Errorf("expected the pool to be kept")
+	}
+	if err := tx.Commit().Error; err != nil {
+		t.Errorf("in-flight transaction failed after rotation: %v", err)
+	}
+	// Handles kept from before the rotation use the new credentials.
+	if first.HasTable(&credentialItem{}) {
+		t.Errorf("expected the pool to use the new database")
+	}
+	if err := conn.Ready(); err != nil {
+		t.Errorf("Ready() after rotation error = %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package goutils_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/RamanPndy/go-utils/utils/dbtest"
+	_ "github.com/RamanPndy/go-utils/utils/sqlite"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	return logger
+}
+
+// newSQLiteTestDB returns a SQLite database for t with models auto-migrated.
+func newSQLiteTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	return dbtest.New(t, &dbtest.Options{Models: models, Logger: newTestLogger()}).DB
+}
+
+func TestBuildDSN(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *goutils.DatabaseConfig
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "Postgres",
+			config:   &goutils.DatabaseConfig{Type: goutils.POSTGRESQL, Address: "db", Port: 5432, User: "app", Password: "secret", Name: "orders", SSL: "disable"},
+			expected: "host=db port=5432 user=app password=secret dbname=orders sslmode=disable",
+		},
+		{
+			name:     "Postgres escaped password",
+			config:   &goutils.DatabaseConfig{Type: goutils.POSTGRESQL, Address: "db", User: "app", Password: `it's a \secret`, Name: "orders"},
+			expected: `host=db user=app password='it\'s a \\secret' dbname=orders`,
+		},
+		{
+			name:     "MySQL",
+			config:   &goutils.DatabaseConfig{Type: goutils.MYSQL, Address: "db", User: "app", Password: "p@ss:w/rd", Name: "orders"},
+			expected: "app:p@ss:w/rd@tcp(db:3306)/orders?parseTime=true",
+		},
+		{
+			name:     "MySQL TLS",
+			config:   &goutils.DatabaseConfig{Type: goutils.MYSQL, Address: "db", Port: 3307, User: "app", Name: "orders", SSL: "verify-full"},
+			expected: "app@tcp(db:3307)/orders?parseTime=true&tls=true",
+		},
+		{
+			name:     "SQLite",
+			config:   &goutils.DatabaseConfig{Type: goutils.SQLITE3, Name: "/tmp/app.db"},
+			expected: "/tmp/app.db",
+		},
+		{
+			name:    "SQLite without name",
+			config:  &goutils.DatabaseConfig{Type: goutils.SQLITE3},
+			wantErr: true,
+		},
+		{
+			name:    "Hotload without DSN",
+			config:  &goutils.DatabaseConfig{Type: goutils.HOTLOADDBType},
+			wantErr: true,
+		},
+		{
+			name:    "Unsupported type",
+			config:  &goutils.DatabaseConfig{Type: "oracle"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := goutils.FormatDSN(tt.config)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got DSN %q", got)
+				}
+				if dsn := goutils.BuildDSN(tt.config); dsn != "" {
+					t.Errorf("BuildDSN() = %q, want empty", dsn)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("FormatDSN() = %q, want %q", got, tt.expected)
+			}
+			if dsn := goutils.BuildDSN(tt.config); dsn != tt.expected {
+				t.Errorf("BuildDSN() = %q, want %q", dsn, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDBConnConnectSQLite(t *testing.T) {
+	config := &goutils.DatabaseConfig{Type: goutils.SQLITE3, Name: filepath.Join(t.TempDir(), "app.db"), MaxOpenConns: 1}
+	conn, err := goutils.NewDBConn(config, newTestLogger())
+	if err != nil {
+		t.Fatalf("NewDBConn() error = %v", err)
+	}
+
+	db, err := conn.Connect()
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer conn.Close(db)
+	if again, err := conn.Connect(); err != nil || again != db {
+		t.Errorf("expected Connect() to return the connected pool, got %p, %v", again, err)
+	}
+
+	if err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)").Error; err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	if err := conn.Ready(); err != nil {
+		t.Errorf("Ready() error = %v", err)
+	}
+	if !conn.IsReady() {
+		t.Errorf("expected IsReady() to be true")
+	}
+	if got := conn.GetDSN(); got != config.Name {
+		t.Errorf("GetDSN() = %q, want %q", got, config.Name)
+	}
+}
+
+func TestOpenDB(t *testing.T) {
+	config := &goutils.DatabaseConfig{Type: goutils.SQLITE3, Name: filepath.Join(t.TempDir(), "app.db")}
+	db, err := goutils.OpenDB(config, newTestLogger())
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+	defer db.Close()
+	if err := db.DB().Ping(); err != nil {
+		t.Errorf("ping: %v", err)
+	}
+
+	if _, err := goutils.OpenDB(&goutils.DatabaseConfig{Type: goutils.POSTGRESQL + "x"}, newTestLogger()); err == nil {
+		t.Errorf("expected error for unsupported type")
+	}
+}
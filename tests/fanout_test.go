@@ -0,0 +1,82 @@
+package goutils_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+)
+
+func TestFanOutOrderAndConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("X-Path", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	requests := make([]*goutils.APIRequest, 20)
+	for i := range requests {
+		requests[i] = goutils.NewAPIRequest().SetMethod(goutils.GET).SetURL(fmt.Sprintf("%s/%d", server.URL, i))
+	}
+
+	results := goutils.NewAPIClient().FanOut(context.Background(), requests, goutils.FanOutOptions{Concurrency: 3})
+	if len(results) != len(requests) {
+		t.Fatalf("expected %d results, got %d", len(requests), len(results))
+	}
+	for i, r := range results {
+		if r.Err != nil {
+			t.Fatalf("result %d error = %v", i, r.Err)
+		}
+		if got, want := r.Result.ResponseHeaders.Get("X-Path"), fmt.Sprintf("/%d", i); got != want {
+			t.Errorf("result %d served %q, want %q", i, got, want)
+		}
+	}
+	if got := atomic.LoadInt32(&maxInFlight); got > 3 {
+		t.Errorf("expected at most 3 requests in flight, got %d", got)
+	}
+}
+
+func TestFanOutFailFast(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	requests := []*goutils.APIRequest{
+		goutils.NewAPIRequest().SetMethod("BOGUS").SetURL(server.URL),
+		goutils.NewAPIRequest().SetMethod(goutils.GET).SetURL(server.URL),
+		goutils.NewAPIRequest().SetMethod(goutils.GET).SetURL(server.URL),
+	}
+
+	start := time.Now()
+	results := goutils.FanOut(context.Background(), goutils.NewAPIClient(), requests, goutils.FanOutOptions{Concurrency: 2, FailFast: true})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected fail fast to cancel pending requests, took %v", elapsed)
+	}
+	for i, r := range results {
+		if r.Err == nil {
+			t.Errorf("expected result %d to fail", i)
+		}
+		if r.Request != requests[i] {
+			t.Errorf("result %d does not reference its request", i)
+		}
+	}
+}
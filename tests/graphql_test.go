@@ -0,0 +1,137 @@
+package goutils_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+)
+
+type graphQLPayload struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	Extensions    map[string]any `json:"extensions"`
+}
+
+func TestGraphQLClientQuery(t *testing.T) {
+	var got graphQLPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("expected authorization header, got %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"user":{"id":"1","name":"Ada"}}}`))
+	}))
+	defer server.Close()
+
+	client := goutils.NewGraphQLClient(goutils.NewAPIClient(), server.URL).SetHeader("Authorization", "Bearer token")
+
+	var data struct {
+		User struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"user"`
+	}
+	query := `query($id: ID!) { user(id: $id) { id name } }`
+	if err := client.Query(context.Background(), query, map[string]any{"id": "1"}, &data); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if data.User.Name != "Ada" {
+		t.Errorf("expected user Ada, got %+v", data.User)
+	}
+	if got.Query != query || got.Variables["id"] != "1" {
+		t.Errorf("unexpected request payload %+v", got)
+	}
+}
+
+func TestGraphQLClientErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"data": {"user": {"id": "1", "email": null}},
+			"errors": [{"message": "forbidden", "path": ["user", "email"], "locations": [{"line": 1, "column": 20}], "extensions": {"code": "FORBIDDEN"}}]
+		}`))
+	}))
+	defer server.Close()
+
+	var data struct {
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	err := goutils.NewGraphQLClient(goutils.NewAPIClient(), server.URL).Query(context.Background(), `{ user { id email } }`, nil, &data)
+
+	var gqlErrs goutils.GraphQLErrors
+	if !errors.As(err, &gqlErrs) {
+		t.Fatalf("expected GraphQLErrors, got %v", err)
+	}
+	if len(gqlErrs) != 1 || gqlErrs[0].PathString() != "user.email" || gqlErrs[0].Code() != "FORBIDDEN" {
+		t.Errorf("unexpected errors %v", gqlErrs)
+	}
+	if gqlErrs[0].Locations[0].Column != 20 {
+		t.Errorf("expected location column 20, got %+v", gqlErrs[0].Locations)
+	}
+	if data.User.ID != "1" {
+		t.Errorf("expected partial data to be decoded, got %+v", data)
+	}
+}
+
+func TestGraphQLClientHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	err := goutils.NewGraphQLClient(goutils.NewAPIClient(), server.URL).Query(context.Background(), `{ ping }`, nil, nil)
+	var httpErr *goutils.GraphQLHTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected GraphQLHTTPError with status 502, got %v", err)
+	}
+}
+
+func TestGraphQLClientPersistedQueries(t *testing.T) {
+	registered := map[string]string{}
+	var requests []graphQLPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload graphQLPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		requests = append(requests, payload)
+
+		persisted, _ := payload.Extensions["persistedQuery"].(map[string]any)
+		hash, _ := persisted["sha256Hash"].(string)
+		if payload.Query != "" {
+			registered[hash] = payload.Query
+		}
+		if _, ok := registered[hash]; !ok {
+			w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"ping":"pong"}}`))
+	}))
+	defer server.Close()
+
+	client := goutils.NewGraphQLClient(goutils.NewAPIClient(), server.URL).EnablePersistedQueries()
+	for i := 0; i < 2; i++ {
+		var data struct {
+			Ping string `json:"ping"`
+		}
+		if err := client.Query(context.Background(), `{ ping }`, nil, &data); err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		if data.Ping != "pong" {
+			t.Errorf("expected pong, got %q", data.Ping)
+		}
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests (miss, register, hit), got %d", len(requests))
+	}
+	if requests[0].Query != "" || requests[1].Query == "" || requests[2].Query != "" {
+		t.Errorf("unexpected persisted query flow %+v", requests)
+	}
+}
@@ -0,0 +1,102 @@
+package goutils_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+)
+
+func TestHedgedClientSendsHedgeAfterDelay(t *testing.T) {
+	var calls, cancelled int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(&cancelled, 1)
+				return
+			case <-time.After(2 * time.Second):
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := goutils.NewHedgedClient(goutils.NewAPIClient(), goutils.HedgePolicy{Delay: 20 * time.Millisecond})
+	request := goutils.NewAPIRequest().SetMethod(goutils.GET).SetURL(server.URL)
+
+	start := time.Now()
+	result, apiErr := client.DoRequest(context.Background(), request)
+	if apiErr != nil {
+		t.Fatalf("DoRequest() error = %v", apiErr)
+	}
+	if result.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", result.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected hedge to answer quickly, took %v", elapsed)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("expected 2 calls, got %d", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&cancelled) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&cancelled) != 1 {
+		t.Errorf("expected the losing request to be cancelled")
+	}
+}
+
+func TestHedgedClientSkipsUnsafeMethods(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client := goutils.NewHedgedClient(goutils.NewAPIClient(), goutils.HedgePolicy{Delay: time.Millisecond})
+	request := goutils.NewAPIRequest().SetMethod(goutils.POST).SetURL(server.URL)
+	if _, apiErr := client.DoRequest(context.Background(), request); apiErr != nil {
+		t.Fatalf("DoRequest() error = %v", apiErr)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("expected 1 call for POST, got %d", got)
+	}
+}
+
+func TestHedgedClientPercentileDelay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	policy := goutils.HedgePolicy{Delay: time.Hour, MinSamples: 5, MaxDelay: time.Minute}
+	client := goutils.NewHedgedClient(goutils.NewAPIClient(), policy)
+	if got := client.HedgeDelay(); got != time.Minute {
+		t.Errorf("expected delay clamped to MaxDelay, got %v", got)
+	}
+
+	request := goutils.NewAPIRequest().SetMethod(goutils.GET).SetURL(server.URL)
+	for i := 0; i < 5; i++ {
+		if _, apiErr := client.DoRequest(context.Background(), request); apiErr != nil {
+			t.Fatalf("DoRequest() error = %v", apiErr)
+		}
+	}
+	if got := client.HedgeDelay(); got >= time.Second {
+		t.Errorf("expected percentile-based delay, got %v", got)
+	}
+}
+
+func TestHedgedClientDefaultDelay(t *testing.T) {
+	client := goutils.NewHedgedClient(goutils.NewAPIClient(), goutils.HedgePolicy{})
+	if got := client.HedgeDelay(); got != goutils.DefaultHedgeDelay {
+		t.Errorf("expected DefaultHedgeDelay, got %v", got)
+	}
+}
@@ -1,6 +1,10 @@
 package goutils_test
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	goutils "github.com/RamanPndy/go-utils/utils"
@@ -48,3 +52,41 @@ func TestEncodeQueryParams(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIClientSendsHeadersAndBody(t *testing.T) {
+	var gotMethod, gotHeader, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotHeader, gotBody = r.Method, r.Header.Get("X-Request-Id"), string(body)
+	}))
+	defer server.Close()
+
+	client := goutils.NewAPIClient()
+	tests := []struct {
+		name string
+		do   func(request *goutils.APIRequest) *goutils.APIError
+	}{
+		{name: "DoRequest", do: func(request *goutils.APIRequest) *goutils.APIError {
+			_, err := client.DoRequest(context.Background(), request)
+			return err
+		}},
+		{name: "DoRequestWithCustomClient", do: func(request *goutils.APIRequest) *goutils.APIError {
+			_, err := client.DoRequestWithCustomClient(context.Background(), request, server.Client())
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotMethod, gotHeader, gotBody = "", "", ""
+			request := goutils.NewAPIRequest().SetMethod(goutils.POST).SetURL(server.URL).
+				AddHeader("X-Request-Id", "42").SetPlainTextBody("hello")
+			if err := tt.do(request); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if gotMethod != http.MethodPost || gotHeader != "42" || gotBody != "hello" {
+				t.Errorf("expected POST with header 42 and body hello, got %s %q %q", gotMethod, gotHeader, gotBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package goutils_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+)
+
+func TestMigrationLockerSQLite(t *testing.T) {
+	conn := newSQLiteConn(t)
+	opts := goutils.MigrationLockOptions{Key: "test", Timeout: 100 * time.Millisecond, PollInterval: 10 * time.Millisecond}
+
+	first, err := conn.NewMigrationLocker(opts)
+	if err != nil {
+		t.Fatalf("NewMigrationLocker() error = %v", err)
+	}
+	second, err := conn.NewMigrationLocker(opts)
+	if err != nil {
+		t.Fatalf("NewMigrationLocker() error = %v", err)
+	}
+
+	ctx := context.Background()
+	if err := first.Lock(ctx); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if err := second.Lock(ctx); !errors.Is(err, goutils.ErrMigrationLockTimeout) {
+		t.Errorf("expected ErrMigrationLockTimeout while the lock is held, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := second.Lock(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if err := first.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if err := second.Lock(ctx); err != nil {
+		t.Errorf("Lock() after Unlock error = %v", err)
+	}
+	if err := second.Unlock(ctx); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+	if err := second.Unlock(ctx); err == nil {
+		t.Errorf("expected error when unlocking a lock that is not held")
+	}
+}
+
+func TestMigrateWithLockConcurrentReplicas(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "app.db")
+	opts := goutils.MigrationLockOptions{Timeout: 10 * time.Second, PollInterval: 10 * time.Millisecond}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := goutils.NewDBConn(&goutils.DatabaseConfig{
+				Type:           goutils.SQLITE3,
+				Name:           dbPath,
+				MigrationsPath: "testdata/migrations",
+			}, newTestLogger())
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = conn.MigrateWithLock(context.Background(), opts)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("replica %d: MigrateWithLock() error = %v", i, err)
+		}
+	}
+	conn, _ := goutils.NewDBConn(&goutils.DatabaseConfig{Type: goutils.SQLITE3, Name: dbPath, MigrationsPath: "testdata/migrations"}, newTestLogger())
+	if version, err := conn.Version(nil); err != nil || version != "3" {
+		t.Errorf("Version() = %q, %v; want 3", version, err)
+	}
+}
+
+func TestWithMigrationLockUnsupported(t *testing.T) {
+	conn, _ := goutils.NewDBConn(&goutils.DatabaseConfig{Type: "oracle", DSN: "oracle://localhost"}, newTestLogger())
+	called := false
+	err := conn.WithMigrationLock(context.Background(), goutils.MigrationLockOptions{}, func() error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Errorf("expected unsupported database error without running fn, got %v (called=%v)", err, called)
+	}
+}
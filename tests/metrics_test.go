@@ -0,0 +1,162 @@
+package goutils_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type metricsItem struct {
+	ID   uint
+	Name string
+}
+
+func metricValue(t *testing.T, registry *prometheus.Registry, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if !hasLabels(metric, labels) {
+				continue
+			}
+			switch {
+			case metric.GetCounter() != nil:
+				return metric.GetCounter().GetValue(), true
+			case metric.GetHistogram() != nil:
+				return float64(metric.GetHistogram().GetSampleCount()), true
+			case metric.GetGauge() != nil:
+				return metric.GetGauge().GetValue(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func hasLabels(metric *dto.Metric, labels map[string]string) bool {
+	found := 0
+	for _, pair := range metric.GetLabel() {
+		if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+			found++
+		}
+	}
+	return found == len(labels)
+}
+
+func TestDBMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	dir := t.TempDir()
+	newDB := func(name string) *goutils.DatabaseConfig {
+		return &goutils.DatabaseConfig{
+			Type:               goutils.SQLITE3,
+			Name:               filepath.Join(dir, name+".db"),
+			MetricsName:        name,
+			MetricsNamespace:   "app",
+			MetricsLabels:      map[string]string{"service": "api"},
+			MetricsRegisterer:  registry,
+			SlowQueryThreshold: time.Nanosecond,
+		}
+	}
+
+	orders, err := goutils.OpenDB(newDB("orders"), newTestLogger())
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+	defer orders.Close()
+	users, err := goutils.OpenDB(newDB("users"), newTestLogger())
+	if err != nil {
+		t.Fatalf("OpenDB() for a second database error = %v", err)
+	}
+	defer users.Close()
+
+	orders.AutoMigrate(&metricsItem{})
+	orders.Create(&metricsItem{Name: "a"})
+	orders.Create(&metricsItem{Name: "b"})
+	var items []metricsItem
+	orders.Find(&items)
+	orders.Table("missing").Find(&items)
+
+	tests := []struct {
+		name     string
+		metric   string
+		labels   map[string]string
+		expected float64
+	}{
+		{name: "Create latency", metric: "app_db_query_duration_seconds", labels: map[string]string{"db_name": "orders", "service": "api", "operation": "create", "table": "metrics_items"}, expected: 2},
+		{name: "Query latency", metric: "app_db_query_duration_seconds", labels: map[string]string{"db_name": "orders", "operation": "query", "table": "metrics_items"}, expected: 1},
+		{name: "Query errors", metric: "app_db_query_errors_total", labels: map[string]string{"db_name": "orders", "operation": "query", "table": "missing"}, expected: 1},
+		{name: "Slow queries", metric: "app_db_slow_queries_total", labels: map[string]string{"db_name": "orders", "operation": "create", "table": "metrics_items"}, expected: 2},
+		{name: "Pool stats", metric: "go_sql_stats_connections_max_open", labels: map[string]string{"db_name": "users", "service": "api"}, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok := metricValue(t, registry, tt.metric, tt.labels)
+			if !ok {
+				t.Fatalf("metric %s%v not found", tt.metric, tt.labels)
+			}
+			if value != tt.expected {
+				t.Errorf("metric %s = %v, want %v", tt.metric, value, tt.expected)
+			}
+		})
+	}
+
+	if _, ok := metricValue(t, registry, "app_db_query_errors_total", map[string]string{"operation": "create"}); ok {
+		t.Errorf("expected no create errors")
+	}
+}
+
+func TestDBMetricsSharedName(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	dir := t.TempDir()
+	newConn := func(file string, maxOpen int) *goutils.DBConn {
+		conn, _ := goutils.NewDBConn(&goutils.DatabaseConfig{
+			Type:              goutils.SQLITE3,
+			Name:              filepath.Join(dir, file),
+			MaxOpenConns:      maxOpen,
+			MetricsName:       "orders",
+			MetricsRegisterer: registry,
+		}, newTestLogger())
+		return conn
+	}
+	maxOpen := func() float64 {
+		value, _ := metricValue(t, registry, "go_sql_stats_connections_max_open", map[string]string{"db_name": "orders"})
+		return value
+	}
+
+	first := newConn("first.db", 3)
+	db, err := first.Connect()
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	second := newConn("second.db", 5)
+	other, err := second.Connect()
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer second.Close(other)
+	if got := maxOpen(); got != 3 {
+		t.Errorf("expected another pool not to replace the stats, got max open %v", got)
+	}
+
+	// Reconnecting replaces the stats of the closed pool.
+	first.Close(db)
+	db, err = first.Connect()
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer first.Close(db)
+	db.DB().Ping()
+	if value, _ := metricValue(t, registry, "go_sql_stats_connections_open", map[string]string{"db_name": "orders"}); value != 1 {
+		t.Errorf("expected the stats of the new pool, got %v open connections", value)
+	}
+}
@@ -0,0 +1,280 @@
+package goutils_test
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+)
+
+func newSQLiteConn(t *testing.T) *goutils.DBConn {
+	t.Helper()
+	config := &goutils.DatabaseConfig{
+		Type:           goutils.SQLITE3,
+		Name:           filepath.Join(t.TempDir(), "app.db"),
+		MigrationsPath: "testdata/migrations",
+	}
+	conn, err := goutils.NewDBConn(config, newTestLogger())
+	if err != nil {
+		t.Fatalf("NewDBConn() error = %v", err)
+	}
+	return conn
+}
+
+func TestMigratorLifecycle(t *testing.T) {
+	conn := newSQLiteConn(t)
+	m, err := conn.NewMigrator()
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	defer m.Close()
+
+	if _, _, err := m.Version(); !errors.Is(err, goutils.ErrNoMigration) {
+		t.Errorf("expected ErrNoMigration, got %v", err)
+	}
+	status, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(status.Applied) != 0 || len(status.Pending) != 3 {
+		t.Errorf("expected 3 pending migrations, got %+v", status)
+	}
+
+	steps := []struct {
+		name    string
+		run     func() error
+		version uint
+		applied int
+	}{
+		{name: "Up", run: m.Up, version: 3, applied: 3},
+		{name: "Up again", run: m.Up, version: 3, applied: 3},
+		{name: "Down one", run: func() error { return m.Down(1) }, version: 2, applied: 2},
+		{name: "Goto 1", run: func() error { return m.Goto(1) }, version: 1, applied: 1},
+		{name: "Goto 3", run: func() error { return m.Goto(3) }, version: 3, applied: 3},
+		{name: "Down more than applied", run: func() error { return m.Down(10) }, version: 0, applied: 0},
+		{name: "Up after rollback", run: m.Up, version: 3, applied: 3},
+		{name: "Down all", run: m.DownAll, version: 0, applied: 0},
+	}
+	if err := m.Down(0); err == nil {
+		t.Errorf("expected Down(0) to be rejected")
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		status, err := m.Status()
+		if err != nil {
+			t.Fatalf("%s: Status() error = %v", step.name, err)
+		}
+		if status.Version != step.version || len(status.Applied) != step.applied {
+			t.Errorf("%s: expected version %d with %d applied, got %+v", step.name, step.version, step.applied, status)
+		}
+	}
+}
+
+func TestMigratorStatusNames(t *testing.T) {
+	conn := newSQLiteConn(t)
+	m, err := conn.NewMigrator()
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Goto(2); err != nil {
+		t.Fatalf("Goto() error = %v", err)
+	}
+	status, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	expected := []goutils.MigrationInfo{
+		{Version: 1, Name: "create_users", Applied: true},
+		{Version: 2, Name: "create_orders", Applied: true},
+		{Version: 3, Name: "add_user_name", Applied: false},
+	}
+	got := append(status.Applied, status.Pending...)
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d migrations, got %+v", len(expected), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("migration %d = %+v, want %+v", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestMigratorDirtyRecovery(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"1_create_users.up.sql":   "CREATE TABLE users (id INTEGER PRIMARY KEY);",
+		"1_create_users.down.sql": "DROP TABLE users;",
+		"2_broken.up.sql":         "CREATE TABLE broken (id INTEGER PRIMARY KEY); SELEC 1;",
+		"2_broken.down.sql":       "DROP TABLE IF EXISTS broken;",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn := newSQLiteConn(t)
+	m, err := conn.NewMigratorFromPath(dir)
+	if err != nil {
+		t.Fatalf("NewMigratorFromPath() error = %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Up(); err == nil {
+		t.Fatalf("expected broken migration to fail")
+	}
+	err = m.Up()
+	var dirty *goutils.DirtyMigrationError
+	if !errors.As(err, &dirty) {
+		t.Fatalf("expected DirtyMigrationError, got %v", err)
+	}
+	if dirty.Version != 2 || dirty.Previous != 1 {
+		t.Errorf("unexpected dirty state %+v", dirty)
+	}
+
+	if err := m.Force(dirty.Previous); err != nil {
+		t.Fatalf("Force() error = %v", err)
+	}
+	version, isDirty, err := m.Version()
+	if err != nil || version != 1 || isDirty {
+		t.Errorf("expected clean version 1, got %d dirty=%v err=%v", version, isDirty, err)
+	}
+}
+
+func TestDBConnMigrateFromPath(t *testing.T) {
+	conn := newSQLiteConn(t)
+	if err := conn.MigrateFromPath(nil, "testdata/migrations"); err != nil {
+		t.Fatalf("MigrateFromPath() error = %v", err)
+	}
+	if version, err := conn.Version(nil); err != nil || version != "3" {
+		t.Errorf("Version() = %q, %v; want 3", version, err)
+	}
+	if err := conn.Rollback(nil); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if err := conn.RollbackFromPath(nil, "testdata/migrations"); err != nil {
+		t.Fatalf("RollbackFromPath() error = %v", err)
+	}
+	if version, err := conn.Version(nil); err != nil || version != "1" {
+		t.Errorf("Version() = %q, %v; want 1", version, err)
+	}
+	if err := conn.RollbackStepsFromPath(nil, "testdata/migrations", 0); err == nil {
+		t.Errorf("expected RollbackStepsFromPath() to reject 0 steps")
+	}
+	if err := conn.RollbackStepsFromPath(nil, "testdata/migrations", 5); err != nil {
+		t.Fatalf("RollbackStepsFromPath() error = %v", err)
+	}
+	if _, err := conn.Version(nil); !errors.Is(err, goutils.ErrNoMigration) {
+		t.Errorf("expected ErrNoMigration after full rollback, got %v", err)
+	}
+}
+
+//go:embed testdata/migrations/*.sql
+var embeddedMigrations embed.FS
+
+func TestMigratorFromFS(t *testing.T) {
+	conn := newSQLiteConn(t)
+	if err := conn.MigrateFromFS(nil, embeddedMigrations, "testdata/migrations"); err != nil {
+		t.Fatalf("MigrateFromFS() error = %v", err)
+	}
+
+	m, err := conn.NewMigratorFromFS(embeddedMigrations, "testdata/migrations")
+	if err != nil {
+		t.Fatalf("NewMigratorFromFS() error = %v", err)
+	}
+	defer m.Close()
+	status, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.Version != 3 || len(status.Applied) != 3 || len(status.Pending) != 0 {
+		t.Errorf("expected all 3 migrations applied, got %+v", status)
+	}
+
+	if err := conn.RollbackFromFS(nil, embeddedMigrations, "testdata/migrations", 2); err != nil {
+		t.Fatalf("RollbackFromFS() error = %v", err)
+	}
+	if version, _, err := m.Version(); err != nil || version != 1 {
+		t.Errorf("Version() = %d, %v; want 1", version, err)
+	}
+
+	if _, err := conn.NewMigratorFromFS(embeddedMigrations, "missing"); err == nil {
+		t.Errorf("expected error for missing directory")
+	}
+}
+
+func TestDBConnMigrationsFS(t *testing.T) {
+	sub, err := fs.Sub(embeddedMigrations, "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &goutils.DatabaseConfig{
+		Type:         goutils.SQLITE3,
+		Name:         filepath.Join(t.TempDir(), "app.db"),
+		MigrationsFS: sub,
+	}
+	conn, err := goutils.NewDBConn(config, newTestLogger())
+	if err != nil {
+		t.Fatalf("NewDBConn() error = %v", err)
+	}
+	m, err := conn.NewMigrator()
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	defer m.Close()
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if err := conn.Rollback(nil); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if version, err := conn.Version(nil); err != nil || version != "2" {
+		t.Errorf("Version() = %q, %v; want 2", version, err)
+	}
+}
+
+func TestCreateMigrationFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{name: "Simple name", input: "create_users", expected: "20240102150405_create_users"},
+		{name: "Spaces and symbols", input: " Add Orders Index! ", expected: "20240102150405_add_orders_index"},
+		{name: "Empty name", input: "--", wantErr: true},
+		{name: "Existing files", input: "create_users", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up, down, err := goutils.CreateMigrationFiles(dir, tt.input, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateMigrationFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if up != filepath.Join(dir, tt.expected+".up.sql") || down != filepath.Join(dir, tt.expected+".down.sql") {
+				t.Errorf("unexpected paths %q, %q", up, down)
+			}
+			for _, path := range []string{up, down} {
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("expected %s to exist: %v", path, err)
+				}
+			}
+		})
+	}
+}
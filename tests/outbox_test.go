@@ -0,0 +1,204 @@
+package goutils_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/jinzhu/gorm"
+)
+
+type outboxOrder struct {
+	ID    uint
+	Total int
+}
+
+type recordingPublisher struct {
+	mu        sync.Mutex
+	published []string
+	fail      map[string]bool
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msg *goutils.OutboxMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail[string(msg.Payload)] {
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, string(msg.Payload))
+	return nil
+}
+
+func (p *recordingPublisher) Published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.published...)
+}
+
+func newTestOutbox(t *testing.T, opts *goutils.OutboxOptions) (*gorm.DB, *goutils.Outbox) {
+	t.Helper()
+	db := newSQLiteTestDB(t, &outboxOrder{})
+	if opts == nil {
+		opts = &goutils.OutboxOptions{}
+	}
+	opts.Logger = &goutils.Logger{Logger: newTestLogger()}
+	outbox := goutils.NewOutbox(db, opts)
+	if err := outbox.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return db, outbox
+}
+
+func enqueue(t *testing.T, db *gorm.DB, outbox *goutils.Outbox, key string, payloads ...string) {
+	t.Helper()
+	for _, payload := range payloads {
+		if _, err := outbox.Enqueue(context.Background(), db, "orders", key, []byte(payload)); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+}
+
+func TestOutboxEnqueueInTransaction(t *testing.T) {
+	db, outbox := newTestOutbox(t, nil)
+	ctx := context.Background()
+
+	for _, commit := range []bool{true, false} {
+		err := goutils.WithTransaction(ctx, db, nil, func(tx *gorm.DB) error {
+			order := outboxOrder{Total: 42}
+			if err := tx.Create(&order).Error; err != nil {
+				return err
+			}
+			if _, err := outbox.EnqueueJSON(ctx, tx, "orders.created", "", order); err != nil {
+				return err
+			}
+			if !commit {
+				return errors.New("rollback")
+			}
+			return nil
+		})
+		if (err == nil) != commit {
+			t.Fatalf("WithTransaction() error = %v", err)
+		}
+	}
+
+	publisher := &recordingPublisher{}
+	n, err := outbox.RelayOnce(ctx, publisher)
+	if err != nil {
+		t.Fatalf("RelayOnce() error = %v", err)
+	}
+	if n != 1 || len(publisher.Published()) != 1 || publisher.Published()[0] != `{"ID":1,"Total":42}` {
+		t.Errorf("expected only the committed message to be published, got %v", publisher.Published())
+	}
+
+	var msg goutils.OutboxMessage
+	db.Table(goutils.DefaultOutboxTable).First(&msg)
+	if msg.DeliveredAt == nil || msg.Attempts != 1 {
+		t.Errorf("expected the message to be marked delivered, got %+v", msg)
+	}
+	if n, _ := outbox.RelayOnce(ctx, publisher); n != 0 {
+		t.Errorf("expected no message to be relayed twice, got %d", n)
+	}
+	if _, err := outbox.Enqueue(ctx, db, "", "", nil); err == nil {
+		t.Error("expected an error for an empty topic")
+	}
+}
+
+func TestOutboxRetries(t *testing.T) {
+	db, outbox := newTestOutbox(t, &goutils.OutboxOptions{InitialBackoff: time.Hour, MaxBackoff: time.Hour, MaxAttempts: 2})
+	ctx := context.Background()
+	enqueue(t, db, outbox, "order-1", "a1", "a2")
+	enqueue(t, db, outbox, "order-2", "b1")
+	enqueue(t, db, outbox, "", "c1")
+
+	publisher := &recordingPublisher{fail: map[string]bool{"a1": true}}
+	if n, err := outbox.RelayOnce(ctx, publisher); err != nil || n != 2 {
+		t.Fatalf("RelayOnce() = %d, %v, expected 2 published messages", n, err)
+	}
+	// a2 waits for a1 to be published.
+	if got := publisher.Published(); len(got) != 2 || got[0] != "b1" || got[1] != "c1" {
+		t.Errorf("expected b1 and c1 to be published, got %v", got)
+	}
+
+	var failed goutils.OutboxMessage
+	db.Table(goutils.DefaultOutboxTable).Where("payload = ?", []byte("a1")).First(&failed)
+	if failed.Attempts != 1 || failed.LastError != "broker unavailable" || !failed.AvailableAt.After(time.Now()) || failed.DeliveredAt != nil {
+		t.Errorf("expected the failure to be recorded and the retry delayed, got %+v", failed)
+	}
+	if n, _ := outbox.RelayOnce(ctx, publisher); n != 0 {
+		t.Errorf("expected the order-1 messages to wait for the backoff, got %d relayed", n)
+	}
+
+	// Make a1 due again; it fails a second time and is given up, releasing a2.
+	db.Table(goutils.DefaultOutboxTable).Where("id = ?", failed.ID).UpdateColumn("available_at", time.Now().Add(-time.Second))
+	outbox.RelayOnce(ctx, publisher)
+	db.Table(goutils.DefaultOutboxTable).Where("id = ?", failed.ID).UpdateColumn("available_at", time.Now().Add(-time.Second))
+	if _, err := outbox.RelayOnce(ctx, publisher); err != nil {
+		t.Fatalf("RelayOnce() error = %v", err)
+	}
+	if got := publisher.Published(); len(got) != 3 || got[2] != "a2" {
+		t.Errorf("expected a2 to be published after a1 was given up, got %v", got)
+	}
+	db.Table(goutils.DefaultOutboxTable).Where("id = ?", failed.ID).First(&failed)
+	if failed.Attempts != 2 || failed.DeliveredAt != nil {
+		t.Errorf("expected a1 to stay undelivered after 2 attempts, got %+v", failed)
+	}
+}
+
+func TestOutboxKeyOrder(t *testing.T) {
+	db, outbox := newTestOutbox(t, nil)
+	ctx := context.Background()
+	enqueue(t, db, outbox, "order-1", "a1", "a2", "a3")
+	enqueue(t, db, outbox, "", "c1")
+
+	publisher := &recordingPublisher{}
+	for i, expected := range []int{2, 1, 1, 0} {
+		if n, err := outbox.RelayOnce(ctx, publisher); err != nil || n != expected {
+			t.Errorf("RelayOnce() #%d = %d, %v, expected %d published messages", i+1, n, err, expected)
+		}
+	}
+	if got := publisher.Published(); len(got) != 4 || got[0] != "a1" || got[1] != "c1" || got[2] != "a2" || got[3] != "a3" {
+		t.Errorf("expected the order-1 messages to be published in order, got %v", got)
+	}
+
+	var attempted int
+	db.Table(goutils.DefaultOutboxTable).Where("attempts > 1").Count(&attempted)
+	if attempted != 0 {
+		t.Errorf("expected every message to be attempted once, got %d attempted again", attempted)
+	}
+}
+
+func TestOutboxRelayAndPurge(t *testing.T) {
+	db, outbox := newTestOutbox(t, &goutils.OutboxOptions{BatchSize: 2, PollInterval: 10 * time.Millisecond})
+	enqueue(t, db, outbox, "", "m1", "m2", "m3")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	publisher := &recordingPublisher{}
+	done := make(chan error)
+	go func() { done <- outbox.Relay(ctx, publisher) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(publisher.Published()) < 4 && time.Now().Before(deadline) {
+		if len(publisher.Published()) == 3 {
+			enqueue(t, db, outbox, "", "m4")
+			for len(publisher.Published()) == 3 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Relay to stop with context.Canceled, got %v", err)
+	}
+	if got := publisher.Published(); len(got) != 4 || got[0] != "m1" || got[3] != "m4" {
+		t.Errorf("expected m1 to m4 to be published in order, got %v", got)
+	}
+
+	n, err := outbox.PurgeDelivered(context.Background(), -time.Minute)
+	if err != nil || n != 4 {
+		t.Errorf("expected 4 delivered messages to be purged, got %d (%v)", n, err)
+	}
+}
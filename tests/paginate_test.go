@@ -0,0 +1,193 @@
+package goutils_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/jinzhu/gorm"
+)
+
+type pageEvent struct {
+	ID        uint
+	Kind      string
+	Score     int
+	CreatedAt time.Time
+}
+
+func newPaginateTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newSQLiteTestDB(t, &pageEvent{})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Scores repeat so that the primary key breaks ties.
+	for i, score := range []int{5, 3, 5, 1, 3, 5, 2} {
+		event := pageEvent{Kind: "click", Score: score, CreatedAt: start.Add(time.Duration(i) * time.Minute)}
+		if i%2 == 1 {
+			event.Kind = "view"
+		}
+		if err := db.Create(&event).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func pageIDs(page *goutils.Page[pageEvent]) []uint {
+	ids := make([]uint, len(page.Items))
+	for i, item := range page.Items {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPaginate(t *testing.T) {
+	db := newPaginateTestDB(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		orderBy  []string
+		expected [][]uint
+	}{
+		{name: "Primary key", expected: [][]uint{{1, 2, 3}, {4, 5, 6}, {7}}},
+		{name: "Descending with ties", orderBy: []string{"-score"}, expected: [][]uint{{6, 3, 1}, {5, 2, 7}, {4}}},
+		{name: "Mixed directions", orderBy: []string{"score", "-created_at"}, expected: [][]uint{{4, 7, 5}, {2, 6, 3}, {1}}},
+		{name: "Time column", orderBy: []string{"-CreatedAt"}, expected: [][]uint{{7, 6, 5}, {4, 3, 2}, {1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pages []*goutils.Page[pageEvent]
+			req := goutils.PageRequest{Limit: 3, OrderBy: tt.orderBy}
+			for {
+				page, err := goutils.Paginate[pageEvent](ctx, db, req)
+				if err != nil {
+					t.Fatalf("Paginate() error = %v", err)
+				}
+				pages = append(pages, page)
+				if page.Next == "" || len(pages) > len(tt.expected) {
+					break
+				}
+				req.After = page.Next
+			}
+			if len(pages) != len(tt.expected) {
+				t.Fatalf("expected %d pages, got %d", len(tt.expected), len(pages))
+			}
+			for i, page := range pages {
+				if !equalIDs(pageIDs(page), tt.expected[i]) {
+					t.Errorf("page %d: expected %v, got %v", i, tt.expected[i], pageIDs(page))
+				}
+				if (page.Prev != "") != (i > 0) {
+					t.Errorf("page %d: unexpected prev cursor %q", i, page.Prev)
+				}
+			}
+
+			// Walk back from the last page.
+			req = goutils.PageRequest{Limit: 3, OrderBy: tt.orderBy, Before: pages[len(pages)-1].Prev}
+			for i := len(pages) - 2; i >= 0; i-- {
+				page, err := goutils.Paginate[pageEvent](ctx, db, req)
+				if err != nil {
+					t.Fatalf("Paginate() error = %v", err)
+				}
+				if !equalIDs(pageIDs(page), tt.expected[i]) {
+					t.Errorf("backward page %d: expected %v, got %v", i, tt.expected[i], pageIDs(page))
+				}
+				if page.Next == "" || (page.Prev != "") != (i > 0) {
+					t.Errorf("backward page %d: unexpected cursors next=%q prev=%q", i, page.Next, page.Prev)
+				}
+				req.Before = page.Prev
+			}
+		})
+	}
+}
+
+func TestPaginateWithConditions(t *testing.T) {
+	db := newPaginateTestDB(t)
+	repo := goutils.NewRepository[pageEvent](db)
+
+	page, err := repo.Paginate(context.Background(), goutils.PageRequest{Limit: 2}, goutils.QueryFilter{Field: "kind", Value: "view"})
+	if err != nil {
+		t.Fatalf("Paginate() error = %v", err)
+	}
+	if !equalIDs(pageIDs(page), []uint{2, 4}) || page.Next == "" {
+		t.Fatalf("expected views 2 and 4 with a next cursor, got %v", pageIDs(page))
+	}
+	page, err = repo.Paginate(context.Background(), goutils.PageRequest{Limit: 2, After: page.Next}, goutils.QueryFilter{Field: "kind", Value: "view"})
+	if err != nil {
+		t.Fatalf("Paginate() error = %v", err)
+	}
+	if !equalIDs(pageIDs(page), []uint{6}) || page.Next != "" {
+		t.Errorf("expected the last view 6 without a next cursor, got %v", pageIDs(page))
+	}
+}
+
+func TestPaginateInvalidCursor(t *testing.T) {
+	db := newPaginateTestDB(t)
+	ctx := context.Background()
+
+	page, err := goutils.Paginate[pageEvent](ctx, db, goutils.PageRequest{Limit: 2, OrderBy: []string{"score"}})
+	if err != nil {
+		t.Fatalf("Paginate() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		req  goutils.PageRequest
+	}{
+		{name: "Garbage", req: goutils.PageRequest{After: "not a cursor"}},
+		{name: "Other sort order", req: goutils.PageRequest{After: page.Next, OrderBy: []string{"-score"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := goutils.Paginate[pageEvent](ctx, db, tt.req); !errors.Is(err, goutils.ErrInvalidCursor) {
+				t.Errorf("expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+
+	if _, err := goutils.Paginate[pageEvent](ctx, db, goutils.PageRequest{OrderBy: []string{"secret"}}); err == nil {
+		t.Error("expected an error for an unknown sort field")
+	}
+}
+
+func TestParsePageRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected goutils.PageRequest
+		wantErr  bool
+	}{
+		{name: "Empty", query: "", expected: goutils.PageRequest{}},
+		{name: "After", query: "after=abc&limit=10", expected: goutils.PageRequest{After: "abc", Limit: 10}},
+		{name: "Before", query: "before=abc", expected: goutils.PageRequest{Before: "abc"}},
+		{name: "Both cursors", query: "after=a&before=b", wantErr: true},
+		{name: "Invalid limit", query: "limit=ten", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			req, err := goutils.ParsePageRequest(values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePageRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (req.After != tt.expected.After || req.Before != tt.expected.Before || req.Limit != tt.expected.Limit) {
+				t.Errorf("expected %+v, got %+v", tt.expected, req)
+			}
+		})
+	}
+}
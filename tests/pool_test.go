@@ -0,0 +1,145 @@
+package goutils_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/sirupsen/logrus"
+)
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Contains(s string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Contains(b.buf.String(), s)
+}
+
+func newPoolConn(t *testing.T, maxOpen, maxIdle int) (*goutils.DBConn, *lockedBuffer) {
+	t.Helper()
+	buf := &lockedBuffer{}
+	logger := logrus.New()
+	logger.SetOutput(buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	conn, err := goutils.NewDBConn(&goutils.DatabaseConfig{
+		Type:         goutils.SQLITE3,
+		Name:         filepath.Join(t.TempDir(), "pool.db"),
+		MaxOpenConns: maxOpen,
+		MaxIdleConns: maxIdle,
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewDBConn() error = %v", err)
+	}
+	return conn, buf
+}
+
+func TestPoolStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxOpen  int
+		expected int
+	}{
+		{name: "SQLite default", maxOpen: 0, expected: 1},
+		{name: "Configured", maxOpen: 5, expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _ := newPoolConn(t, tt.maxOpen, 0)
+			if stats := conn.PoolStats(); stats.MaxOpenConnections != 0 || stats.OpenConnections != 0 {
+				t.Errorf("expected zero stats before Connect, got %+v", stats)
+			}
+			db, err := conn.Connect()
+			if err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			defer conn.Close(db)
+			if stats := conn.PoolStats(); stats.MaxOpenConnections != tt.expected || stats.OpenConnections != 1 {
+				t.Errorf("expected %d max and 1 open connections, got %+v", tt.expected, stats)
+			}
+		})
+	}
+}
+
+func waitForLog(t *testing.T, buf *lockedBuffer, s string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !buf.Contains(s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a log containing %q", s)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMonitorPoolWarnsOnWaits(t *testing.T) {
+	conn, buf := newPoolConn(t, 1, 1)
+	db, err := conn.Connect()
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer conn.Close(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.MonitorPool(ctx, &goutils.PoolMonitorOptions{Interval: 10 * time.Millisecond, WaitDurationThreshold: 10 * time.Millisecond})
+
+	// The single connection is held, so the ping waits for it.
+	held, err := db.DB().Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() { held.Close() })
+	if err := db.DB().PingContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitForLog(t, buf, "consider raising maxOpenConns")
+}
+
+func TestMonitorPoolAdaptive(t *testing.T) {
+	conn, buf := newPoolConn(t, 4, 1)
+	db, err := conn.Connect()
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer conn.Close(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.MonitorPool(ctx, &goutils.PoolMonitorOptions{Interval: 20 * time.Millisecond, Adaptive: true, IdleClosedThreshold: 2})
+	// Let the monitor take its initial statistics first.
+	time.Sleep(50 * time.Millisecond)
+
+	// Releasing 3 connections with a single idle slot closes 2 of them.
+	var conns []interface{ Close() error }
+	for i := 0; i < 3; i++ {
+		c, err := db.DB().Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, c)
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+
+	waitForLog(t, buf, "consider raising maxIdleConns")
+	waitForLog(t, buf, `"from":1,"idle":1,"in_use":0,"level":"info"`)
+	// Without pressure, the idle connections shrink back.
+	waitForLog(t, buf, `"from":2,"idle":1,"in_use":0,"level":"info"`)
+}
@@ -0,0 +1,151 @@
+package goutils_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/sirupsen/logrus"
+)
+
+type queryLogItem struct {
+	ID    uint
+	Email string
+}
+
+func newQueryLogger() (*goutils.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetLevel(logrus.DebugLevel)
+	return &goutils.Logger{Logger: logger}, &buf
+}
+
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	buf.Reset()
+	return entries
+}
+
+func TestQueryLogging(t *testing.T) {
+	logger, buf := newQueryLogger()
+	db, err := goutils.OpenDB(&goutils.DatabaseConfig{
+		Type: goutils.SQLITE3,
+		Name: filepath.Join(t.TempDir(), "log.db"),
+	}, newTestLogger())
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+	defer db.Close()
+	db.AutoMigrate(&queryLogItem{})
+
+	tests := []struct {
+		name          string
+		opts          *goutils.QueryLogOptions
+		run           func()
+		expectedLevel string
+		expectedMsg   string
+		expectedCount int
+	}{
+		{
+			name:          "Fast queries are not logged",
+			opts:          &goutils.QueryLogOptions{Logger: logger, SlowThreshold: time.Hour},
+			run:           func() { db.Create(&queryLogItem{Email: "a@example.com"}) },
+			expectedCount: 0,
+		},
+		{
+			name:          "Slow queries are logged with redacted parameters",
+			opts:          &goutils.QueryLogOptions{Logger: logger, SlowThreshold: time.Nanosecond},
+			run:           func() { db.Create(&queryLogItem{Email: "b@example.com"}) },
+			expectedLevel: "warning",
+			expectedMsg:   "slow query",
+			expectedCount: 1,
+		},
+		{
+			name:          "Failed queries are logged as errors",
+			opts:          &goutils.QueryLogOptions{Logger: logger, SlowThreshold: time.Hour},
+			run:           func() { db.Table("missing").Find(&[]queryLogItem{}) },
+			expectedLevel: "error",
+			expectedMsg:   "query failed",
+			expectedCount: 1,
+		},
+		{
+			name:          "Sampled queries are logged at debug",
+			opts:          &goutils.QueryLogOptions{Logger: logger, SlowThreshold: time.Hour, SampleRate: 1, LogParameters: true},
+			run:           func() { db.Where("email = ?", "b@example.com").Find(&[]queryLogItem{}) },
+			expectedLevel: "debug",
+			expectedMsg:   "query",
+			expectedCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goutils.EnableQueryLogging(db, tt.opts)
+			buf.Reset()
+			tt.run()
+			entries := logEntries(t, buf)
+			if len(entries) != tt.expectedCount {
+				t.Fatalf("expected %d log entries, got %v", tt.expectedCount, entries)
+			}
+			if tt.expectedCount == 0 {
+				return
+			}
+			entry := entries[0]
+			if entry["level"] != tt.expectedLevel || entry["msg"] != tt.expectedMsg {
+				t.Errorf("unexpected entry %v", entry)
+			}
+			caller, _ := entry["caller"].(string)
+			if !strings.HasPrefix(caller, "tests/querylog_test.go:") {
+				t.Errorf("expected caller in the test file, got %q", caller)
+			}
+			for _, field := range []string{"operation", "table", "duration", "rows_affected", "sql"} {
+				if _, ok := entry[field]; !ok {
+					t.Errorf("missing field %q in %v", field, entry)
+				}
+			}
+			params, _ := json.Marshal(entry["params"])
+			if tt.opts.LogParameters != strings.Contains(string(params), "b@example.com") {
+				t.Errorf("unexpected params %s", params)
+			}
+		})
+	}
+}
+
+func TestQueryLoggingFromConfig(t *testing.T) {
+	logger, buf := newQueryLogger()
+	db, err := goutils.OpenDB(&goutils.DatabaseConfig{
+		Type:               goutils.SQLITE3,
+		Name:               filepath.Join(t.TempDir(), "log.db"),
+		SlowQueryThreshold: time.Nanosecond,
+		QueryLog:           &goutils.QueryLogOptions{},
+	}, logger.Logger)
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+	defer db.Close()
+
+	buf.Reset()
+	db.AutoMigrate(&queryLogItem{})
+	db.Create(&queryLogItem{Email: "c@example.com"})
+	entries := logEntries(t, buf)
+	if len(entries) == 0 || entries[len(entries)-1]["msg"] != "slow query" || entries[len(entries)-1]["operation"] != "create" {
+		t.Errorf("expected slow create query logged through the DBConn logger, got %v", entries)
+	}
+}
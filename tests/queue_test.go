@@ -0,0 +1,249 @@
+package goutils_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/jinzhu/gorm"
+)
+
+func newTestJobQueue(t *testing.T, opts *goutils.JobQueueOptions) (*gorm.DB, *goutils.JobQueue) {
+	t.Helper()
+	db := newSQLiteTestDB(t)
+	if opts == nil {
+		opts = &goutils.JobQueueOptions{}
+	}
+	opts.Logger = &goutils.Logger{Logger: newTestLogger()}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = 5 * time.Millisecond
+	}
+	queue := goutils.NewJobQueue(db, opts)
+	if err := queue.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return db, queue
+}
+
+// runJobs runs queue until until returns true or a timeout, then shuts it down.
+func runJobs(t *testing.T, queue *goutils.JobQueue, until func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- queue.Run(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for !until() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+func jobState(t *testing.T, db *gorm.DB, id uint64) goutils.Job {
+	t.Helper()
+	var job goutils.Job
+	if err := db.Table(goutils.DefaultJobTable).Where("id = ?", id).First(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestJobQueuePriorityAndConcurrency(t *testing.T) {
+	db, queue := newTestJobQueue(t, &goutils.JobQueueOptions{Concurrency: 3})
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var ran []string
+	running, maxRunning := 0, 0
+	queue.Handle("email", func(ctx context.Context, job *goutils.Job) error {
+		mu.Lock()
+		ran = append(ran, string(job.Payload))
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+
+	for i, payload := range []string{"low", "high", "later"} {
+		opts := &goutils.EnqueueOptions{Priority: i % 2 * 10}
+		if payload == "later" {
+			opts.RunAt = time.Now().Add(time.Hour)
+		}
+		if _, err := queue.Enqueue(ctx, db, "email", []byte(payload), opts); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	for i := 0; i < 6; i++ {
+		queue.Enqueue(ctx, db, "email", []byte("bulk"), nil)
+	}
+	queue.Enqueue(ctx, db, "unhandled", nil, nil)
+
+	runJobs(t, queue, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(ran) == 8 && running == 0
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ran) != 8 || ran[0] != "high" {
+		t.Errorf("expected 8 jobs to run starting with the high priority one, got %v", ran)
+	}
+	if maxRunning < 2 || maxRunning > 3 {
+		t.Errorf("expected up to 3 jobs to run at once, got %d", maxRunning)
+	}
+	var counts []struct {
+		State goutils.JobState
+		Count int
+	}
+	db.Table(goutils.DefaultJobTable).Select("state, count(*) AS count").Group("state").Order("state").Scan(&counts)
+	if len(counts) != 2 || counts[0].State != goutils.JobPending || counts[0].Count != 2 || counts[1].Count != 8 {
+		t.Errorf("expected 8 succeeded and 2 pending jobs, got %+v", counts)
+	}
+}
+
+func TestJobQueueRetriesAndDeadLetter(t *testing.T) {
+	db, queue := newTestJobQueue(t, &goutils.JobQueueOptions{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	queue.Handle("sync", func(ctx context.Context, job *goutils.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[string(job.Payload)]++
+		switch string(job.Payload) {
+		case "flaky":
+			if job.Attempts < 3 {
+				return errors.New("temporary failure")
+			}
+		case "broken":
+			panic("bad payload")
+		}
+		return nil
+	})
+	flaky, _ := queue.Enqueue(ctx, db, "sync", []byte("flaky"), nil)
+	broken, _ := queue.Enqueue(ctx, db, "sync", []byte("broken"), &goutils.EnqueueOptions{MaxAttempts: 2})
+
+	finished := func() bool {
+		return jobState(t, db, flaky.ID).State == goutils.JobSucceeded && jobState(t, db, broken.ID).State == goutils.JobDead
+	}
+	runJobs(t, queue, finished)
+
+	if job := jobState(t, db, flaky.ID); job.State != goutils.JobSucceeded || job.Attempts != 3 || job.FinishedAt == nil {
+		t.Errorf("expected the flaky job to succeed on the third attempt, got %+v", job)
+	}
+	job := jobState(t, db, broken.ID)
+	if job.State != goutils.JobDead || job.Attempts != 2 || job.LastError != "job panicked: bad payload" {
+		t.Errorf("expected the broken job to be dead after 2 attempts, got %+v", job)
+	}
+
+	if err := queue.Requeue(ctx, broken.ID); err != nil {
+		t.Fatalf("Requeue() error = %v", err)
+	}
+	if job := jobState(t, db, broken.ID); job.State != goutils.JobPending || job.Attempts != 0 {
+		t.Errorf("expected the requeued job to be pending, got %+v", job)
+	}
+	if err := queue.Requeue(ctx, flaky.ID); !goutils.IsNotFound(err) {
+		t.Errorf("expected only dead jobs to be requeued, got %v", err)
+	}
+	if n, err := queue.PurgeSucceeded(ctx, -time.Minute); err != nil || n != 1 {
+		t.Errorf("expected 1 succeeded job to be purged, got %d (%v)", n, err)
+	}
+}
+
+func TestJobQueueUniqueKey(t *testing.T) {
+	db, queue := newTestJobQueue(t, nil)
+	ctx := context.Background()
+
+	opts := &goutils.EnqueueOptions{UniqueKey: "report-2024-01"}
+	first, err := queue.Enqueue(ctx, db, "reports", nil, opts)
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if _, err := queue.Enqueue(ctx, db, "reports", nil, opts); !errors.Is(err, goutils.ErrDuplicateJob) {
+		t.Errorf("expected ErrDuplicateJob, got %v", err)
+	}
+	if _, err := queue.Enqueue(ctx, db, "reports", nil, &goutils.EnqueueOptions{UniqueKey: "report-2024-02"}); err != nil {
+		t.Errorf("expected another key to be accepted, got %v", err)
+	}
+
+	queue.Handle("reports", func(ctx context.Context, job *goutils.Job) error { return nil })
+	runJobs(t, queue, func() bool { return jobState(t, db, first.ID).State == goutils.JobSucceeded })
+	if _, err := queue.Enqueue(ctx, db, "reports", nil, opts); err != nil {
+		t.Errorf("expected the key to be reusable once the job finished, got %v", err)
+	}
+}
+
+func TestJobQueueVisibilityTimeout(t *testing.T) {
+	db, queue := newTestJobQueue(t, &goutils.JobQueueOptions{VisibilityTimeout: time.Hour})
+	ctx := context.Background()
+
+	job, _ := queue.Enqueue(ctx, db, "work", []byte("orphan"), &goutils.EnqueueOptions{MaxAttempts: 3})
+	// Simulate a worker that died while running the job.
+	db.Table(goutils.DefaultJobTable).Where("id = ?", job.ID).UpdateColumns(map[string]interface{}{
+		"state":        goutils.JobRunning,
+		"attempts":     1,
+		"locked_by":    "dead-worker",
+		"locked_until": time.Now().Add(-time.Second),
+	})
+
+	var ran bool
+	var mu sync.Mutex
+	queue.Handle("work", func(ctx context.Context, job *goutils.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = job.Attempts == 2
+		return nil
+	})
+	runJobs(t, queue, func() bool { return jobState(t, db, job.ID).State == goutils.JobSucceeded })
+	mu.Lock()
+	defer mu.Unlock()
+	if !ran {
+		t.Error("expected the orphaned job to be run again as a second attempt")
+	}
+}
+
+func TestJobQueueGracefulShutdown(t *testing.T) {
+	db, queue := newTestJobQueue(t, &goutils.JobQueueOptions{ShutdownTimeout: 20 * time.Millisecond})
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	queue.Handle("slow", func(ctx context.Context, job *goutils.Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	job, _ := queue.Enqueue(ctx, db, "slow", nil, nil)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- queue.Run(runCtx) }()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job did not start")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the shutdown timeout")
+	}
+
+	state := jobState(t, db, job.ID)
+	if state.State != goutils.JobPending || state.Attempts != 0 || state.LockedBy != "" {
+		t.Errorf("expected the interrupted job to be requeued without counting the attempt, got %+v", state)
+	}
+}
@@ -0,0 +1,150 @@
+package goutils_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestIsDBAuthError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "Postgres invalid password", err: &pq.Error{Code: "28P01"}, expected: true},
+		{name: "Postgres invalid authorization", err: &pq.Error{Code: "28000"}, expected: true},
+		{name: "Postgres too many connections", err: &pq.Error{Code: "53300"}, expected: false},
+		{name: "MySQL access denied", err: &mysql.MySQLError{Number: 1045}, expected: true},
+		{name: "MySQL database access denied", err: &mysql.MySQLError{Number: 1044}, expected: true},
+		{name: "MySQL too many connections", err: &mysql.MySQLError{Number: 1040}, expected: false},
+		{name: "Network error", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := goutils.IsDBAuthError(tt.err); got != tt.expected {
+				t.Errorf("IsDBAuthError() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWaitReadyRetriesUntilReachable(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	conn, _ := goutils.NewDBConn(&goutils.DatabaseConfig{Type: goutils.SQLITE3, Name: filepath.Join(dir, "app.db")}, newTestLogger())
+	opts := &goutils.WaitReadyOptions{InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	limited := *opts
+	limited.MaxAttempts = 3
+	if err := conn.WaitReady(context.Background(), &limited); err == nil {
+		t.Fatalf("expected WaitReady to give up while the database is unreachable")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := conn.WaitReady(ctx, opts); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		os.MkdirAll(dir, 0o755)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := conn.WaitReady(ctx, opts); err != nil {
+		t.Errorf("WaitReady() error = %v", err)
+	}
+}
+
+func TestReadyUsesConnectedPool(t *testing.T) {
+	conn, _ := goutils.NewDBConn(&goutils.DatabaseConfig{Type: goutils.SQLITE3, Name: filepath.Join(t.TempDir(), "app.db")}, newTestLogger())
+	db, err := conn.Connect()
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if err := conn.Ready(); err != nil {
+		t.Fatalf("Ready() error = %v", err)
+	}
+
+	db.DB().Close()
+	if conn.IsReady() {
+		t.Errorf("expected Ready to ping the connected (now closed) pool")
+	}
+	if err := conn.WaitReady(context.Background(), &goutils.WaitReadyOptions{MaxAttempts: 1}); err == nil {
+		t.Errorf("expected WaitReady to fail on the closed pool")
+	}
+
+	conn.Close(db)
+	if err := conn.Ready(); err != nil {
+		t.Errorf("expected Ready to use a temporary pool after Close, got %v", err)
+	}
+}
+
+// fakePostgres rejects every connection with an invalid_password error.
+func fakePostgres(t *testing.T) (string, *int32) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var connections int32
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&connections, 1)
+			go func(c net.Conn) {
+				defer c.Close()
+				var size uint32
+				if binary.Read(c, binary.BigEndian, &size) != nil || size < 4 {
+					return
+				}
+				if _, err := io.CopyN(io.Discard, c, int64(size-4)); err != nil {
+					return
+				}
+				fields := "SFATAL\x00C28P01\x00Mpassword authentication failed\x00\x00"
+				msg := []byte{'E', 0, 0, 0, 0}
+				binary.BigEndian.PutUint32(msg[1:], uint32(4+len(fields)))
+				c.Write(append(msg, fields...))
+			}(c)
+		}
+	}()
+	return listener.Addr().String(), &connections
+}
+
+func TestWaitReadyFailsFastOnAuthError(t *testing.T) {
+	addr, connections := fakePostgres(t)
+	host, port, _ := net.SplitHostPort(addr)
+	conn, _ := goutils.NewDBConn(&goutils.DatabaseConfig{
+		Type: goutils.POSTGRESQL,
+		DSN:  fmt.Sprintf("host=%s port=%s user=app password=wrong dbname=app sslmode=disable", host, port),
+	}, newTestLogger())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := conn.WaitReady(ctx, &goutils.WaitReadyOptions{InitialBackoff: time.Millisecond})
+	if !goutils.IsDBAuthError(err) {
+		t.Fatalf("expected an authentication error, got %v", err)
+	}
+	if n := atomic.LoadInt32(connections); n != 1 {
+		t.Errorf("expected a single attempt, got %d", n)
+	}
+}
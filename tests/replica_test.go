@@ -0,0 +1,181 @@
+package goutils_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type replicaItem struct {
+	ID   uint
+	Name string
+}
+
+func newReplicatedDB(t *testing.T, policy string, replicas ...goutils.ReplicaConfig) *goutils.ReplicatedDB {
+	t.Helper()
+	conn, _ := goutils.NewDBConn(&goutils.DatabaseConfig{
+		Type:          goutils.SQLITE3,
+		Name:          filepath.Join(t.TempDir(), "primary.db"),
+		Replicas:      replicas,
+		ReplicaPolicy: policy,
+	}, newTestLogger())
+	db, err := conn.ConnectReplicated()
+	if err != nil {
+		t.Fatalf("ConnectReplicated() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestReplicatedDBRouting(t *testing.T) {
+	dir := t.TempDir()
+	db := newReplicatedDB(t, "",
+		goutils.ReplicaConfig{Name: filepath.Join(dir, "replica1.db")},
+		goutils.ReplicaConfig{Name: filepath.Join(dir, "replica2.db")},
+	)
+
+	if db.HealthyReplicas() != 2 {
+		t.Fatalf("expected 2 healthy replicas, got %d", db.HealthyReplicas())
+	}
+	first, second, third := db.Reader(), db.Reader(), db.Reader()
+	if first == second || first != third {
+		t.Errorf("expected round-robin across replicas")
+	}
+	if first == db.Writer() || second == db.Writer() {
+		t.Errorf("expected reads not to use the primary")
+	}
+
+	err := db.Transaction(context.Background(), nil, func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&replicaItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&replicaItem{Name: "written"}).Error
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+	var count int
+	if err := db.Writer().Model(&replicaItem{}).Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("expected the write on the primary, got %d rows (%v)", count, err)
+	}
+}
+
+func TestReplicatedDBLeastConnections(t *testing.T) {
+	dir := t.TempDir()
+	db := newReplicatedDB(t, goutils.ReplicaLeastConnections,
+		goutils.ReplicaConfig{Name: filepath.Join(dir, "replica1.db")},
+		goutils.ReplicaConfig{Name: filepath.Join(dir, "replica2.db")},
+	)
+
+	busy := db.Reader()
+	tx := busy.Begin()
+	defer tx.Rollback()
+	if reader := db.Reader(); reader == busy {
+		t.Errorf("expected the replica with fewer connections in use")
+	}
+}
+
+func TestReplicatedDBHealthChecks(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "replicas")
+	db := newReplicatedDB(t, "", goutils.ReplicaConfig{Name: filepath.Join(dir, "replica.db")})
+
+	if db.HealthyReplicas() != 0 || db.Reader() != db.Writer() {
+		t.Fatalf("expected unreachable replica to be skipped and reads to use the primary")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	db.CheckHealth()
+	if db.HealthyReplicas() != 1 || db.Reader() == db.Writer() {
+		t.Fatalf("expected recovered replica to serve reads")
+	}
+
+	// Health checks ping the replica's own pool.
+	db.Reader().DB().Close()
+	db.CheckHealth()
+	if db.HealthyReplicas() != 0 || db.Reader() != db.Writer() {
+		t.Errorf("expected failing replica to be removed from the read pool")
+	}
+}
+
+func TestConnectReplicatedInvalidPolicy(t *testing.T) {
+	conn, _ := goutils.NewDBConn(&goutils.DatabaseConfig{
+		Type:          goutils.SQLITE3,
+		Name:          filepath.Join(t.TempDir(), "primary.db"),
+		ReplicaPolicy: "random",
+	}, newTestLogger())
+	if _, err := conn.ConnectReplicated(); err == nil {
+		t.Errorf("expected error for unsupported policy")
+	}
+}
+
+func TestReplicatedDBMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	dir := t.TempDir()
+	conn, _ := goutils.NewDBConn(&goutils.DatabaseConfig{
+		Type:              goutils.SQLITE3,
+		Name:              filepath.Join(dir, "primary.db"),
+		MaxOpenConns:      2,
+		MetricsName:       "orders",
+		MetricsRegisterer: registry,
+		Replicas:          []goutils.ReplicaConfig{{Name: filepath.Join(dir, "replica.db")}},
+	}, newTestLogger())
+	db, err := conn.ConnectReplicated()
+	if err != nil {
+		t.Fatalf("ConnectReplicated() error = %v", err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"orders", "orders-replica-0"} {
+		if value, ok := metricValue(t, registry, "go_sql_stats_connections_max_open", map[string]string{"db_name": name}); !ok || value != 2 {
+			t.Errorf("expected pool stats for %s, got %v (found %v)", name, value, ok)
+		}
+	}
+}
+
+func TestReplicatedDBCloseAndReconnect(t *testing.T) {
+	dir := t.TempDir()
+	conn, _ := goutils.NewDBConn(&goutils.DatabaseConfig{
+		Type:     goutils.SQLITE3,
+		Name:     filepath.Join(dir, "primary.db"),
+		Replicas: []goutils.ReplicaConfig{{Name: filepath.Join(dir, "replica.db")}},
+	}, newTestLogger())
+	first, err := conn.ConnectReplicated()
+	if err != nil {
+		t.Fatalf("ConnectReplicated() error = %v", err)
+	}
+	defer first.Close()
+	firstReader := first.Reader()
+
+	second, err := conn.ConnectReplicated()
+	if err != nil {
+		t.Fatalf("ConnectReplicated() again error = %v", err)
+	}
+	if err := firstReader.DB().Ping(); err == nil {
+		t.Errorf("expected the previous replica pool to be closed")
+	}
+	if err := second.Reader().DB().Ping(); err != nil {
+		t.Errorf("expected the new replica pool to work, got %v", err)
+	}
+
+	if err := second.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if conn.DB() != nil {
+		t.Errorf("expected Close to release the primary of the DBConn")
+	}
+	db, err := conn.Connect()
+	if err != nil {
+		t.Fatalf("Connect() after Close error = %v", err)
+	}
+	defer conn.Close(db)
+	if err := db.DB().Ping(); err != nil {
+		t.Errorf("expected a working pool after reconnecting, got %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package goutils_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/jinzhu/gorm"
+)
+
+type repoUser struct {
+	ID        uint
+	Email     string `gorm:"unique_index"`
+	Name      string
+	Age       int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+}
+
+func newTestRepository(t *testing.T) *goutils.Repository[repoUser] {
+	t.Helper()
+	db := newSQLiteTestDB(t, &repoUser{})
+
+	repo := goutils.NewRepository[repoUser](db)
+	for _, u := range []repoUser{
+		{Email: "ann@example.com", Name: "Ann", Age: 31},
+		{Email: "bob@example.com", Name: "Bob", Age: 25},
+		{Email: "cid@example.com", Name: "Cid", Age: 42},
+	} {
+		if err := repo.Create(context.Background(), &u); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	return repo
+}
+
+func TestRepositoryGet(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	user, err := repo.Get(ctx, 2)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if user.Name != "Bob" {
+		t.Errorf("expected Bob, got %s", user.Name)
+	}
+
+	_, err = repo.Get(ctx, 99)
+	var notFound *goutils.NotFoundError
+	if !errors.As(err, &notFound) || notFound.Key != 99 {
+		t.Errorf("expected NotFoundError for key 99, got %v", err)
+	}
+	if !goutils.IsNotFound(err) || !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected the error to match gorm.ErrRecordNotFound, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := repo.Get(cancelled, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRepositoryList(t *testing.T) {
+	repo := newTestRepository(t)
+
+	tests := []struct {
+		name     string
+		opts     goutils.ListOptions
+		expected []string
+		wantErr  bool
+	}{
+		{name: "All", opts: goutils.ListOptions{OrderBy: []string{"id"}}, expected: []string{"Ann", "Bob", "Cid"}},
+		{name: "Descending", opts: goutils.ListOptions{OrderBy: []string{"-age"}}, expected: []string{"Cid", "Ann", "Bob"}},
+		{
+			name:     "Filters by column and field name",
+			opts:     goutils.ListOptions{Filters: []goutils.QueryFilter{{Field: "age", Op: ">", Value: 26}, {Field: "Name", Op: "!=", Value: "Cid"}}},
+			expected: []string{"Ann"},
+		},
+		{
+			name:     "In",
+			opts:     goutils.ListOptions{Filters: []goutils.QueryFilter{{Field: "name", Op: "in", Value: []string{"Bob", "Cid"}}}, OrderBy: []string{"name"}},
+			expected: []string{"Bob", "Cid"},
+		},
+		{
+			name:     "Like",
+			opts:     goutils.ListOptions{Filters: []goutils.QueryFilter{{Field: "email", Op: "like", Value: "b%"}}},
+			expected: []string{"Bob"},
+		},
+		{name: "Limit and offset", opts: goutils.ListOptions{OrderBy: []string{"name"}, Limit: 1, Offset: 1}, expected: []string{"Bob"}},
+		{name: "Unknown field", opts: goutils.ListOptions{OrderBy: []string{"password"}}, wantErr: true},
+		{name: "Unknown operator", opts: goutils.ListOptions{Filters: []goutils.QueryFilter{{Field: "age", Op: "; DROP", Value: 1}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, err := repo.List(context.Background(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("List() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			names := make([]string, len(users))
+			for i, u := range users {
+				names[i] = u.Name
+			}
+			if len(names) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, names)
+			}
+			for i := range names {
+				if names[i] != tt.expected[i] {
+					t.Errorf("expected %v, got %v", tt.expected, names)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestRepositoryUpdate(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	// Only the masked fields are written, zero values included.
+	if err := repo.Update(ctx, &repoUser{ID: 1, Name: "Anne", Age: 0}, "age"); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	user, _ := repo.Get(ctx, 1)
+	if user.Name != "Ann" || user.Age != 0 {
+		t.Errorf("expected name Ann and age 0, got %s and %d", user.Name, user.Age)
+	}
+
+	user.Name = "Anne"
+	if err := repo.Update(ctx, user); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if user, _ := repo.Get(ctx, 1); user.Name != "Anne" || user.Email != "ann@example.com" {
+		t.Errorf("expected the full update to be saved, got %+v", user)
+	}
+
+	if err := repo.Update(ctx, &repoUser{ID: 99, Name: "Nobody"}, "name"); !goutils.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	if err := repo.Update(ctx, &repoUser{ID: 1}, "password"); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestRepositoryDelete(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	if err := repo.Delete(ctx, 1); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := repo.Get(ctx, 1); !goutils.IsNotFound(err) {
+		t.Errorf("expected a soft-deleted user not to be found, got %v", err)
+	}
+	if err := repo.Delete(ctx, 1); !goutils.IsNotFound(err) {
+		t.Errorf("expected deleting twice to be not found, got %v", err)
+	}
+	deleted, err := repo.List(ctx, goutils.ListOptions{IncludeDeleted: true})
+	if err != nil || len(deleted) != 3 {
+		t.Errorf("expected 3 users including deleted ones, got %d (%v)", len(deleted), err)
+	}
+
+	if err := repo.HardDelete(ctx, 1); err != nil {
+		t.Fatalf("HardDelete() error = %v", err)
+	}
+	if deleted, _ := repo.List(ctx, goutils.ListOptions{IncludeDeleted: true}); len(deleted) != 2 {
+		t.Errorf("expected 2 users after the hard delete, got %d", len(deleted))
+	}
+}
+
+func TestRepositoryUpsert(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	user := &repoUser{Email: "bob@example.com", Name: "Robert", Age: 26}
+	if err := repo.Upsert(ctx, user, []string{"email"}, "name"); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if user.ID != 2 || user.Name != "Robert" || user.Age != 25 {
+		t.Errorf("expected only the name of user 2 to be updated, got %+v", user)
+	}
+
+	user = &repoUser{Email: "dan@example.com", Name: "Dan", Age: 50}
+	if err := repo.Upsert(ctx, user, []string{"email"}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if user.ID == 0 || user.ID == 2 {
+		t.Errorf("expected a new user, got id %d", user.ID)
+	}
+	id := user.ID
+
+	user = &repoUser{Email: "dan@example.com", Name: "Daniel", Age: 51}
+	if err := repo.Upsert(ctx, user, []string{"email"}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if user.ID != id || user.Name != "Daniel" || user.Age != 51 {
+		t.Errorf("expected all columns of user %d to be updated, got %+v", id, user)
+	}
+	if count, _ := repo.Count(ctx); count != 4 {
+		t.Errorf("expected 4 users, got %d", count)
+	}
+
+	// The stored row is reloaded even if the entity carries another primary key.
+	user = &repoUser{ID: 99, Email: "cid@example.com", Name: "Cidney"}
+	if err := repo.Upsert(ctx, user, []string{"email"}, "name"); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if user.ID != 3 || user.Name != "Cidney" || user.Age != 42 {
+		t.Errorf("expected user 3 to be reloaded, got %+v", user)
+	}
+}
+
+func TestRepositoryCountAndExists(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	count, err := repo.Count(ctx, goutils.QueryFilter{Field: "age", Op: ">=", Value: 31})
+	if err != nil || count != 2 {
+		t.Errorf("expected 2 users, got %d (%v)", count, err)
+	}
+	if exists, err := repo.Exists(ctx, goutils.QueryFilter{Field: "email", Value: "cid@example.com"}); err != nil || !exists {
+		t.Errorf("expected cid to exist, got %v (%v)", exists, err)
+	}
+	if exists, err := repo.Exists(ctx, goutils.QueryFilter{Field: "email", Value: "eve@example.com"}); err != nil || exists {
+		t.Errorf("expected eve not to exist, got %v (%v)", exists, err)
+	}
+}
+
+func TestRepositoryWithDB(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	err := goutils.WithTransaction(ctx, repo.DB(), nil, func(tx *gorm.DB) error {
+		if err := repo.WithDB(tx).Create(ctx, &repoUser{Email: "eve@example.com", Name: "Eve"}); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("expected the transaction to fail")
+	}
+	if exists, _ := repo.Exists(ctx, goutils.QueryFilter{Field: "email", Value: "eve@example.com"}); exists {
+		t.Error("expected the insert to be rolled back")
+	}
+}
@@ -0,0 +1,242 @@
+package goutils_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/RamanPndy/go-utils/utils/dbtest"
+)
+
+type schemaUser struct {
+	ID     uint
+	Email  string `gorm:"size:255;not null;unique_index"`
+	Name   string `gorm:"size:100"`
+	Active bool
+}
+
+func (schemaUser) TableName() string {
+	return "users"
+}
+
+type schemaTag struct {
+	ID        uint
+	Label     string  `gorm:"unique"`
+	Weight    float64 `gorm:"index"`
+	CreatedAt time.Time
+}
+
+func (schemaTag) TableName() string {
+	return "tags"
+}
+
+func TestCheckSchemaAfterAutoMigrate(t *testing.T) {
+	testDB := dbtest.New(t, &dbtest.Options{Models: []interface{}{&schemaUser{}, &schemaTag{}}})
+	diff, err := testDB.Conn.CheckSchema(context.Background(), &schemaUser{}, &schemaTag{})
+	if err != nil {
+		t.Fatalf("CheckSchema() error = %v", err)
+	}
+	if !diff.Empty() {
+		t.Errorf("expected no drift after AutoMigrate, got:\n%s", diff)
+	}
+}
+
+func TestInspectSchema(t *testing.T) {
+	testDB := dbtest.New(t, &dbtest.Options{MigrationsPath: "testdata/migrations"})
+	schema, err := testDB.Conn.InspectSchema(context.Background())
+	if err != nil {
+		t.Fatalf("InspectSchema() error = %v", err)
+	}
+
+	if schema.Table("schema_migrations") != nil {
+		t.Error("expected the migrations table to be left out")
+	}
+	users := schema.Table("users")
+	if users == nil {
+		t.Fatal("expected a users table")
+	}
+	expectedColumns := []goutils.SchemaColumn{
+		{Name: "id", Type: "integer", AutoIncrement: true},
+		{Name: "email", Type: "varchar(255)"},
+		{Name: "name", Type: "varchar(100)", Nullable: true},
+	}
+	if !reflect.DeepEqual(users.Columns, expectedColumns) {
+		t.Errorf("expected columns %+v, got %+v", expectedColumns, users.Columns)
+	}
+
+	orders := schema.Table("orders")
+	if orders == nil {
+		t.Fatal("expected an orders table")
+	}
+	expectedIndexes := []goutils.SchemaIndex{{Name: "idx_orders_user_id", Columns: []string{"user_id"}}}
+	if !reflect.DeepEqual(orders.Indexes, expectedIndexes) {
+		t.Errorf("expected indexes %+v, got %+v", expectedIndexes, orders.Indexes)
+	}
+	expectedFKs := []goutils.SchemaForeignKey{{Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}}}
+	if !reflect.DeepEqual(orders.ForeignKeys, expectedFKs) {
+		t.Errorf("expected foreign keys %+v, got %+v", expectedFKs, orders.ForeignKeys)
+	}
+	if !reflect.DeepEqual(orders.PrimaryKey, []string{"id"}) {
+		t.Errorf("expected primary key [id], got %v", orders.PrimaryKey)
+	}
+}
+
+func TestSchemaDriftMigration(t *testing.T) {
+	ctx := context.Background()
+	testDB := dbtest.New(t, &dbtest.Options{MigrationsPath: "testdata/migrations"})
+	models := []interface{}{&schemaUser{}, &schemaTag{}}
+
+	diff, err := testDB.Conn.CheckSchema(ctx, models...)
+	if err != nil {
+		t.Fatalf("CheckSchema() error = %v", err)
+	}
+	expected := []string{
+		"add table tags",
+		"add column users.active bool",
+		"add index users.uix_users_email unique (email)",
+	}
+	var changes []string
+	for _, change := range diff.Changes {
+		changes = append(changes, change.String())
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("expected changes %q, got %q", expected, changes)
+	}
+
+	// The generated migration follows the applied ones.
+	dir := t.TempDir()
+	migrations, _ := filepath.Glob("testdata/migrations/*.sql")
+	for _, path := range migrations {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(path)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upPath, downPath, err := diff.WriteMigrationFiles(dir, "fix drift", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("WriteMigrationFiles() error = %v", err)
+	}
+	if filepath.Base(upPath) != "20240102030405_fix_drift.up.sql" {
+		t.Errorf("unexpected up file %s", upPath)
+	}
+	up, _ := os.ReadFile(upPath)
+	down, _ := os.ReadFile(downPath)
+	if !strings.Contains(string(up), `CREATE UNIQUE INDEX "uix_users_email" ON "users" ("email")`) ||
+		!strings.Contains(string(down), `DROP TABLE "tags"`) {
+		t.Errorf("unexpected migration files:\n%s\n%s", up, down)
+	}
+
+	// Applying the generated migrations fixes the drift, and rolling them back restores it.
+	m, err := testDB.Conn.NewMigratorFromPath(dir)
+	if err != nil {
+		t.Fatalf("NewMigratorFromPath() error = %v", err)
+	}
+	defer m.Close()
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if diff, err := testDB.Conn.CheckSchema(ctx, models...); err != nil || !diff.Empty() {
+		t.Errorf("expected no drift after the migration, got %v:\n%s", err, diff)
+	}
+	if err := m.Down(1); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+	if diff, err := testDB.Conn.CheckSchema(ctx, models...); err != nil || len(diff.Changes) != len(expected) {
+		t.Errorf("expected the drift back after the rollback, got %v:\n%s", err, diff)
+	}
+}
+
+func TestSchemaDiffSQL(t *testing.T) {
+	table := func(dialect string, email goutils.SchemaColumn, indexes []goutils.SchemaIndex, fks []goutils.SchemaForeignKey) *goutils.Schema {
+		return &goutils.Schema{Dialect: dialect, Tables: []goutils.SchemaTable{{
+			Name:        "users",
+			Columns:     []goutils.SchemaColumn{{Name: "id", Type: "bigint", AutoIncrement: true}, email},
+			PrimaryKey:  []string{"id"},
+			Indexes:     indexes,
+			ForeignKeys: fks,
+		}}}
+	}
+	oldEmail := goutils.SchemaColumn{Name: "email", Type: "text", Nullable: true}
+	newEmail := goutils.SchemaColumn{Name: "email", Type: "character varying(255)"}
+	index := []goutils.SchemaIndex{{Name: "idx_users_email", Columns: []string{"email"}}}
+	fk := []goutils.SchemaForeignKey{{Name: "fk_users_org", Columns: []string{"id"}, RefTable: "orgs", RefColumns: []string{"id"}}}
+
+	tests := []struct {
+		name     string
+		expected *goutils.Schema
+		actual   *goutils.Schema
+		up       []string
+		down     []string
+		wantErr  bool
+	}{
+		{
+			name:     "Postgres alter column and foreign key",
+			expected: table(goutils.POSTGRESQL, newEmail, nil, fk),
+			actual:   table(goutils.POSTGRESQL, oldEmail, index, nil),
+			up: []string{
+				`DROP INDEX "idx_users_email"`,
+				`ALTER TABLE "users" ALTER COLUMN "email" TYPE character varying(255)`,
+				`ALTER TABLE "users" ALTER COLUMN "email" SET NOT NULL`,
+				`ALTER TABLE "users" ADD CONSTRAINT "fk_users_org" FOREIGN KEY ("id") REFERENCES "orgs" ("id")`,
+			},
+			down: []string{
+				`ALTER TABLE "users" DROP CONSTRAINT "fk_users_org"`,
+				`ALTER TABLE "users" ALTER COLUMN "email" TYPE text`,
+				`ALTER TABLE "users" ALTER COLUMN "email" DROP NOT NULL`,
+				`CREATE INDEX "idx_users_email" ON "users" ("email")`,
+			},
+		},
+		{
+			name:     "Postgres create table",
+			expected: table(goutils.POSTGRESQL, newEmail, index, nil),
+			actual:   &goutils.Schema{Dialect: goutils.POSTGRESQL},
+			up: []string{
+				"CREATE TABLE \"users\" (\n\t\"id\" bigserial NOT NULL,\n\t\"email\" character varying(255) NOT NULL,\n\tPRIMARY KEY (\"id\")\n)",
+				`CREATE INDEX "idx_users_email" ON "users" ("email")`,
+			},
+			down: []string{`DROP TABLE "users"`},
+		},
+		{
+			name:     "MySQL modify column and drop index",
+			expected: table(goutils.MYSQL, goutils.SchemaColumn{Name: "email", Type: "varchar(255)"}, nil, nil),
+			actual:   table(goutils.MYSQL, goutils.SchemaColumn{Name: "email", Type: "longtext", Nullable: true}, index, nil),
+			up: []string{
+				"DROP INDEX `idx_users_email` ON `users`",
+				"ALTER TABLE `users` MODIFY COLUMN `email` varchar(255) NOT NULL",
+			},
+			down: []string{
+				"ALTER TABLE `users` MODIFY COLUMN `email` longtext",
+				"CREATE INDEX `idx_users_email` ON `users` (`email`)",
+			},
+		},
+		{
+			name:     "SQLite alter column",
+			expected: table(goutils.SQLITE3, newEmail, nil, nil),
+			actual:   table(goutils.SQLITE3, oldEmail, nil, nil),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up, down, err := goutils.DiffSchemas(tt.expected, tt.actual).SQL()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SQL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(up, tt.up) {
+				t.Errorf("expected up %q, got %q", tt.up, up)
+			}
+			if !reflect.DeepEqual(down, tt.down) {
+				t.Errorf("expected down %q, got %q", tt.down, down)
+			}
+		})
+	}
+}
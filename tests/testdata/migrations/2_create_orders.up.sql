@@ -0,0 +1,6 @@
+CREATE TABLE orders (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    total INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX idx_orders_user_id ON orders (user_id);
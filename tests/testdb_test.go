@@ -0,0 +1,122 @@
+package goutils_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/RamanPndy/go-utils/utils/dbtest"
+)
+
+var testFixtures = []string{"testdata/fixtures/users.yaml", "testdata/fixtures/orders.json"}
+
+func TestDBTestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *dbtest.Options
+	}{
+		{name: "File with migrations path", opts: &dbtest.Options{MigrationsPath: "testdata/migrations", Fixtures: testFixtures}},
+		{name: "In memory with migrations fs", opts: &dbtest.Options{InMemory: true, MigrationsFS: embeddedMigrations, MigrationsPath: "testdata/migrations", Fixtures: testFixtures}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB := dbtest.New(t, tt.opts)
+			dbtest.AssertRowCount(t, testDB.DB, "users", 2)
+			dbtest.AssertRowCount(t, testDB.DB, "orders", 2, "user_id = ?", 1)
+			dbtest.AssertRow(t, testDB.DB, "users", map[string]interface{}{"id": 2, "email": "bob@example.com", "name": "Bob"})
+			dbtest.AssertNoRow(t, testDB.DB, "users", map[string]interface{}{"email": "eve@example.com"})
+		})
+	}
+}
+
+func TestDBTestTxIsRolledBack(t *testing.T) {
+	testDB := dbtest.New(t, &dbtest.Options{MigrationsPath: "testdata/migrations", Fixtures: testFixtures})
+
+	t.Run("Writes", func(t *testing.T) {
+		tx := testDB.Tx(t)
+		if err := tx.Exec("INSERT INTO users (id, email) VALUES (3, 'eve@example.com')").Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Exec("DELETE FROM orders").Error; err != nil {
+			t.Fatal(err)
+		}
+		dbtest.AssertRow(t, tx, "users", map[string]interface{}{"email": "eve@example.com"})
+		dbtest.AssertRowCount(t, tx, "orders", 0)
+	})
+	t.Run("Sees the fixtures only", func(t *testing.T) {
+		tx := testDB.Tx(t)
+		dbtest.AssertNoRow(t, tx, "users", map[string]interface{}{"email": "eve@example.com"})
+		dbtest.AssertRowCount(t, tx, "orders", 3)
+	})
+	t.Run("Leaves the pool usable", func(t *testing.T) {
+		tx := testDB.Tx(t)
+		tx.Exec("DELETE FROM orders")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var count int
+		if err := testDB.DB.DB().QueryRowContext(ctx, "SELECT COUNT(*) FROM orders").Scan(&count); err != nil || count != 3 {
+			t.Errorf("expected the pool to see the 3 committed orders, got %d (%v)", count, err)
+		}
+	})
+}
+
+func TestLoadFixtures(t *testing.T) {
+	fsys := fstest.MapFS{
+		"fixtures.yaml": {Data: []byte("items:\n  - id: 1\n    price: 9.5\n    tags: [a, b]\n    active: true\n")},
+		"broken.yaml":   {Data: []byte("items:\n  - id: 2\n    missing_column: 1\n")},
+	}
+	testDB := dbtest.New(t, &dbtest.Options{Models: []interface{}{&fixtureItem{}}, FixturesFS: fsys, Fixtures: []string{"fixtures.yaml"}})
+
+	var item fixtureItem
+	if err := testDB.DB.First(&item).Error; err != nil {
+		t.Fatalf("First() error = %v", err)
+	}
+	if item.Price != 9.5 || item.Tags != `["a","b"]` || !item.Active {
+		t.Errorf("expected the fixture values to be converted, got %+v", item)
+	}
+
+	if err := dbtest.LoadFixtures(testDB.DB, fsys, "broken.yaml"); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+	if err := dbtest.LoadFixtures(testDB.DB, fsys, "missing.yaml"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestLoadFixturesInFileOrder(t *testing.T) {
+	testDB := dbtest.New(t, nil)
+	for _, statement := range []string{
+		"CREATE TABLE zoos (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE animals (id INTEGER PRIMARY KEY, zoo_id INTEGER)",
+		// Stands in for a foreign key, which SQLite does not enforce by default.
+		"CREATE TRIGGER animals_zoo BEFORE INSERT ON animals WHEN NOT EXISTS (SELECT 1 FROM zoos WHERE id = NEW.zoo_id)" +
+			" BEGIN SELECT RAISE(ABORT, 'unknown zoo'); END",
+	} {
+		if err := testDB.DB.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsys := fstest.MapFS{
+		"zoos.yaml": {Data: []byte("zoos:\n  - id: 1\nanimals:\n  - id: 1\n    zoo_id: 1\n")},
+		"zoos.json": {Data: []byte(`{"zoos": [{"id": 2}], "animals": [{"id": 2, "zoo_id": 2}]}`)},
+	}
+	for _, path := range []string{"zoos.yaml", "zoos.json"} {
+		if err := dbtest.LoadFixtures(testDB.DB, fsys, path); err != nil {
+			t.Errorf("LoadFixtures(%s) error = %v", path, err)
+		}
+	}
+	dbtest.AssertRowCount(t, testDB.DB, "animals", 2)
+}
+
+type fixtureItem struct {
+	ID     uint
+	Price  float64
+	Tags   string
+	Active bool
+}
+
+func (fixtureItem) TableName() string {
+	return "items"
+}
@@ -0,0 +1,175 @@
+package goutils_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+type txItem struct {
+	ID   uint
+	Name string
+}
+
+func countTxItems(t *testing.T, db *gorm.DB) int {
+	t.Helper()
+	var count int
+	if err := db.Model(&txItem{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "Postgres serialization failure", err: &pq.Error{Code: "40001"}, expected: true},
+		{name: "Postgres deadlock", err: &pq.Error{Code: "40P01"}, expected: true},
+		{name: "Postgres unique violation", err: &pq.Error{Code: "23505"}, expected: false},
+		{name: "MySQL deadlock", err: &mysql.MySQLError{Number: 1213}, expected: true},
+		{name: "MySQL lock wait timeout", err: &mysql.MySQLError{Number: 1205}, expected: true},
+		{name: "MySQL duplicate entry", err: &mysql.MySQLError{Number: 1062}, expected: false},
+		{name: "Wrapped error", err: errors.Join(errors.New("insert"), &pq.Error{Code: "40001"}), expected: true},
+		{name: "Other error", err: errors.New("boom"), expected: false},
+		{name: "Nil error", err: nil, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := goutils.IsRetryableTxError(tt.err); got != tt.expected {
+				t.Errorf("IsRetryableTxError() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWithTransactionCommitAndRollback(t *testing.T) {
+	db := newSQLiteTestDB(t, &txItem{})
+	ctx := context.Background()
+
+	err := goutils.WithTransaction(ctx, db, nil, func(tx *gorm.DB) error {
+		return tx.Create(&txItem{Name: "committed"}).Error
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction() error = %v", err)
+	}
+
+	errFailed := errors.New("failed")
+	err = goutils.WithTransaction(ctx, db, nil, func(tx *gorm.DB) error {
+		if err := tx.Create(&txItem{Name: "rolled back"}).Error; err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("expected fn error, got %v", err)
+	}
+	if count := countTxItems(t, db); count != 1 {
+		t.Errorf("expected 1 committed row, got %d", count)
+	}
+}
+
+func TestWithTransactionPanic(t *testing.T) {
+	db := newSQLiteTestDB(t, &txItem{})
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Errorf("expected panic to be re-raised, got %v", p)
+		}
+		if count := countTxItems(t, db); count != 0 {
+			t.Errorf("expected rollback after panic, got %d rows", count)
+		}
+	}()
+	goutils.WithTransaction(context.Background(), db, nil, func(tx *gorm.DB) error {
+		tx.Create(&txItem{Name: "panic"})
+		panic("boom")
+	})
+}
+
+func TestWithTransactionRetries(t *testing.T) {
+	db := newSQLiteTestDB(t, &txItem{})
+	opts := &goutils.TxOptions{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	tests := []struct {
+		name             string
+		failures         int
+		err              error
+		expectedAttempts int
+		wantErr          bool
+	}{
+		{name: "Succeeds after serialization failures", failures: 2, err: &pq.Error{Code: "40001"}, expectedAttempts: 3},
+		{name: "Gives up after MaxRetries", failures: 10, err: &mysql.MySQLError{Number: 1213}, expectedAttempts: 4, wantErr: true},
+		{name: "Does not retry other errors", failures: 10, err: errors.New("constraint"), expectedAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := goutils.WithTransaction(context.Background(), db, opts, func(tx *gorm.DB) error {
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WithTransaction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.expectedAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.expectedAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestWithTransactionNestedSavepoint(t *testing.T) {
+	db := newSQLiteTestDB(t, &txItem{})
+	ctx := context.Background()
+
+	err := goutils.WithTransaction(ctx, db, nil, func(tx *gorm.DB) error {
+		if err := tx.Create(&txItem{Name: "outer"}).Error; err != nil {
+			return err
+		}
+		innerErr := goutils.WithTransaction(ctx, tx, nil, func(tx *gorm.DB) error {
+			tx.Create(&txItem{Name: "inner"})
+			return errors.New("inner failed")
+		})
+		if innerErr == nil {
+			t.Errorf("expected inner error")
+		}
+		return goutils.WithTransaction(ctx, tx, nil, func(tx *gorm.DB) error {
+			return tx.Create(&txItem{Name: "inner committed"}).Error
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction() error = %v", err)
+	}
+
+	var names []string
+	db.Model(&txItem{}).Order("id").Pluck("name", &names)
+	if len(names) != 2 || names[0] != "outer" || names[1] != "inner committed" {
+		t.Errorf("unexpected rows %v", names)
+	}
+}
+
+func TestWithTransactionCancelledContext(t *testing.T) {
+	db := newSQLiteTestDB(t, &txItem{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	err := goutils.WithTransaction(ctx, db, nil, func(tx *gorm.DB) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || called {
+		t.Errorf("expected context.Canceled without calling fn, got %v (called=%v)", err, called)
+	}
+}
@@ -0,0 +1,199 @@
+package goutils_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+)
+
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookReceiverGitHub(t *testing.T) {
+	receiver, err := goutils.NewWebhookReceiver(goutils.GitHubWebhookConfig("old-secret", "new-secret"))
+	if err != nil {
+		t.Fatalf("NewWebhookReceiver() error = %v", err)
+	}
+
+	type pushEvent struct {
+		Ref string `json:"ref"`
+	}
+	var refs []string
+	goutils.HandleWebhook(receiver, "push", func(ctx context.Context, event *goutils.WebhookEvent, payload pushEvent) error {
+		refs = append(refs, payload.Ref)
+		return nil
+	})
+
+	body := `{"ref":"refs/heads/main"}`
+	newRequest := func(signature, delivery string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(body))
+		req.Header.Set("X-Hub-Signature-256", signature)
+		req.Header.Set("X-GitHub-Delivery", delivery)
+		req.Header.Set("X-GitHub-Event", "push")
+		return req
+	}
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		expected int
+	}{
+		{name: "Valid signature", req: newRequest("sha256="+sign("new-secret", body), "delivery-1"), expected: http.StatusOK},
+		{name: "Rotated secret", req: newRequest("sha256="+sign("old-secret", body), "delivery-2"), expected: http.StatusOK},
+		{name: "Replayed delivery", req: newRequest("sha256="+sign("new-secret", body), "delivery-1"), expected: http.StatusOK},
+		{name: "Wrong secret", req: newRequest("sha256="+sign("other", body), "delivery-3"), expected: http.StatusUnauthorized},
+		{name: "Missing prefix", req: newRequest(sign("new-secret", body), "delivery-4"), expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			receiver.ServeHTTP(rec, tt.req)
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d (%s)", tt.expected, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if len(refs) != 2 {
+		t.Errorf("expected 2 dispatched events, got %d", len(refs))
+	}
+}
+
+func TestWebhookReceiverStripe(t *testing.T) {
+	receiver, err := goutils.NewWebhookReceiver(goutils.StripeWebhookConfig("whsec_test"))
+	if err != nil {
+		t.Fatalf("NewWebhookReceiver() error = %v", err)
+	}
+
+	var handled int
+	receiver.Handle("invoice.paid", func(ctx context.Context, event *goutils.WebhookEvent) error {
+		handled++
+		if event.ID != "evt_1" {
+			t.Errorf("expected delivery id evt_1, got %q", event.ID)
+		}
+		return nil
+	})
+	receiver.Handle("invoice.failed", func(ctx context.Context, event *goutils.WebhookEvent) error {
+		return errors.New("downstream unavailable")
+	})
+
+	newRequest := func(body string, timestamp time.Time) *http.Request {
+		ts := fmt.Sprint(timestamp.Unix())
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", strings.NewReader(body))
+		req.Header.Set("Stripe-Signature", "t="+ts+",v1="+sign("whsec_test", ts+"."+body))
+		return req
+	}
+
+	paid := `{"id":"evt_1","type":"invoice.paid"}`
+	failed := `{"id":"evt_2","type":"invoice.failed"}`
+	tests := []struct {
+		name     string
+		req      *http.Request
+		expected int
+	}{
+		{name: "Valid event", req: newRequest(paid, time.Now()), expected: http.StatusOK},
+		{name: "Stale timestamp", req: newRequest(`{"id":"evt_3","type":"invoice.paid"}`, time.Now().Add(-time.Hour)), expected: http.StatusUnauthorized},
+		{name: "Unhandled type", req: newRequest(`{"id":"evt_4","type":"customer.created"}`, time.Now()), expected: http.StatusAccepted},
+		{name: "Handler failure", req: newRequest(failed, time.Now()), expected: http.StatusInternalServerError},
+		{name: "Handler failure retried", req: newRequest(failed, time.Now()), expected: http.StatusInternalServerError},
+		{name: "Duplicate event", req: newRequest(paid, time.Now()), expected: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			receiver.ServeHTTP(rec, tt.req)
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d (%s)", tt.expected, rec.Code, rec.Body.String())
+			}
+			if strings.Contains(rec.Body.String(), "timestamp") {
+				t.Errorf("expected verification details not to be returned, got %q", rec.Body.String())
+			}
+		})
+	}
+
+	if handled != 1 {
+		t.Errorf("expected invoice.paid to be handled once, got %d", handled)
+	}
+}
+
+func TestHMACVerifierWithTimestampHeader(t *testing.T) {
+	verifier := &goutils.HMACVerifier{
+		Secrets:         [][]byte{[]byte("secret")},
+		Header:          "X-Signature",
+		TimestampHeader: "X-Timestamp",
+	}
+	body := []byte(`{}`)
+	header := http.Header{}
+	header.Set("X-Timestamp", "1700000000")
+	header.Set("X-Signature", sign("secret", "1700000000.{}"))
+
+	ts, err := verifier.Verify(header, body)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if ts.Unix() != 1700000000 {
+		t.Errorf("expected timestamp 1700000000, got %d", ts.Unix())
+	}
+
+	header.Set("X-Timestamp", "1700000001")
+	if _, err := verifier.Verify(header, body); !errors.Is(err, goutils.ErrWebhookSignature) {
+		t.Errorf("expected ErrWebhookSignature, got %v", err)
+	}
+}
+
+func TestNewWebhookReceiverWithoutSecrets(t *testing.T) {
+	for _, config := range []goutils.WebhookConfig{
+		goutils.GitHubWebhookConfig(),
+		goutils.StripeWebhookConfig(""),
+	} {
+		if _, err := goutils.NewWebhookReceiver(config); err == nil {
+			t.Errorf("expected an error for a verifier without secrets")
+		}
+	}
+}
+
+func TestMemoryDeliveryStore(t *testing.T) {
+	ctx := context.Background()
+	store := goutils.NewMemoryDeliveryStore()
+	claim := func(id string, ttl time.Duration) bool {
+		t.Helper()
+		claimed, err := store.Claim(ctx, id, ttl)
+		if err != nil {
+			t.Fatalf("Claim() error = %v", err)
+		}
+		return claimed
+	}
+
+	if !claim("a", 10*time.Millisecond) || !claim("b", time.Hour) {
+		t.Fatal("expected new deliveries to be claimed")
+	}
+	if claim("a", time.Hour) {
+		t.Error("expected a duplicate delivery to be rejected")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !claim("a", time.Hour) {
+		t.Error("expected an expired delivery to be claimed again")
+	}
+	if claim("b", time.Hour) {
+		t.Error("expected an unexpired delivery to stay claimed")
+	}
+	store.Release(ctx, "b")
+	if !claim("b", time.Hour) {
+		t.Error("expected a released delivery to be claimed again")
+	}
+}
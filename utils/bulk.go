@@ -0,0 +1,245 @@
+package goutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// maxBindParameters is the number of bind parameters a statement may hold.
+var maxBindParameters = map[string]int{
+	POSTGRESQL: 65535,
+	MYSQL:      65535,
+	SQLITE3:    32766,
+}
+
+// BulkOptions controls BulkInsert and BulkUpsert. A nil *BulkOptions uses the defaults.
+type BulkOptions struct {
+	// BatchSize is the number of rows per INSERT statement. It is lowered to fit
+	// the bind parameter limit of the dialect, which is also the default.
+	BatchSize int
+	// UpdateColumns are the columns BulkUpsert overwrites on conflict. They default
+	// to all columns but the primary key, the conflict columns and created_at.
+	UpdateColumns []string
+	// DisableCopy makes BulkInsert use INSERT statements on Postgres rather than
+	// COPY, which is much faster and loads all the rows in a single transaction.
+	DisableCopy bool
+}
+
+// BulkInsert inserts rows with multi-row INSERT statements, or COPY on Postgres,
+// and returns the number of rows inserted. Primary keys are only inserted if set
+// in some row and are not read back. CreatedAt and UpdatedAt are inserted as the
+// current time when zero, without changing rows, but gorm callbacks and hooks do not run. Run it in a transaction if the INSERT
+// batches must be atomic.
+func BulkInsert[T any](ctx context.Context, db *gorm.DB, rows []T, opts *BulkOptions) (int64, error) {
+	return bulkInsert(ctx, db, rows, nil, opts)
+}
+
+// BulkUpsert is like BulkInsert but updates the existing rows that conflict on
+// conflictColumns, using ON CONFLICT or ON DUPLICATE KEY UPDATE. On MySQL the
+// rows affected count updated rows twice.
+func BulkUpsert[T any](ctx context.Context, db *gorm.DB, rows []T, conflictColumns []string, opts *BulkOptions) (int64, error) {
+	if len(conflictColumns) == 0 {
+		return 0, errors.New("bulk upsert: no conflict columns")
+	}
+	return bulkInsert(ctx, db, rows, conflictColumns, opts)
+}
+
+func bulkInsert[T any](ctx context.Context, db *gorm.DB, rows []T, conflictFields []string, opts *BulkOptions) (int64, error) {
+	var o BulkOptions
+	if opts != nil {
+		o = *opts
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	var model T
+	scope := db.NewScope(&model)
+	dialect := db.Dialect()
+	columns, values := bulkValues(db, rows)
+
+	if !o.DisableCopy && conflictFields == nil && dialect.GetName() == POSTGRESQL {
+		return copyRows(ctx, db, scope.TableName(), columns, values)
+	}
+
+	var clause string
+	if conflictFields != nil {
+		known := modelColumns(db, &model)
+		conflict, err := resolveBulkColumns(known, conflictFields)
+		if err != nil {
+			return 0, err
+		}
+		update, err := resolveBulkColumns(known, o.UpdateColumns)
+		if err != nil {
+			return 0, err
+		}
+		if len(update) == 0 {
+			update = upsertUpdateColumns(scope, conflict)
+		}
+		if clause, err = upsertClause(dialect, conflict, update); err != nil {
+			return 0, err
+		}
+	}
+
+	batchSize := len(rows)
+	if limit, ok := maxBindParameters[dialect.GetName()]; ok && batchSize*len(columns) > limit {
+		batchSize = limit / len(columns)
+	}
+	if o.BatchSize > 0 && o.BatchSize < batchSize {
+		batchSize = o.BatchSize
+	}
+
+	execer, ok := db.CommonDB().(interface {
+		ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	})
+	if !ok {
+		return 0, errors.New("bulk insert: database does not support contexts")
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = dialect.Quote(column)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", scope.QuotedTableName(), strings.Join(quoted, ", "))
+
+	var total int64
+	for start := 0; start < len(values); start += batchSize {
+		end := start + batchSize
+		if end > len(values) {
+			end = len(values)
+		}
+		var query strings.Builder
+		query.WriteString(prefix)
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for i, row := range values[start:end] {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteString("(")
+			for j, value := range row {
+				if j > 0 {
+					query.WriteString(", ")
+				}
+				args = append(args, value)
+				query.WriteString(bindVar(dialect, len(args)))
+			}
+			query.WriteString(")")
+		}
+		if clause != "" {
+			query.WriteString(" " + clause)
+		}
+
+		result, err := execer.ExecContext(ctx, query.String(), args...)
+		if err != nil {
+			return total, fmt.Errorf("bulk insert of rows %d to %d: %w", start, end-1, err)
+		}
+		affected, _ := result.RowsAffected()
+		total += affected
+	}
+	return total, nil
+}
+
+// bindVar returns the placeholder of the i-th parameter. Apart from Postgres,
+// gorm dialects return "$$$", which gorm itself replaces by "?".
+func bindVar(dialect gorm.Dialect, i int) string {
+	if v := dialect.BindVar(i); v != "$$$" {
+		return v
+	}
+	return "?"
+}
+
+func resolveBulkColumns(known map[string]string, fields []string) ([]string, error) {
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		column, ok := known[field]
+		if !ok {
+			return nil, fmt.Errorf("bulk upsert: unknown field %q", field)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// bulkValues returns the columns to insert and the values of each row, leaving
+// out the primary keys when no row sets them.
+func bulkValues[T any](db *gorm.DB, rows []T) ([]string, [][]interface{}) {
+	withPrimaryKeys := false
+	for i := range rows {
+		if !db.NewScope(&rows[i]).PrimaryKeyZero() {
+			withPrimaryKeys = true
+			break
+		}
+	}
+
+	now := gorm.NowFunc()
+	var columns []string
+	values := make([][]interface{}, len(rows))
+	for i := range rows {
+		for _, field := range db.NewScope(&rows[i]).Fields() {
+			if !field.IsNormal || field.IsIgnored || (field.IsPrimaryKey && !withPrimaryKeys) {
+				continue
+			}
+			value := field.Field.Interface()
+			if (field.Name == "CreatedAt" || field.Name == "UpdatedAt") && field.IsBlank {
+				value = now
+			}
+			if i == 0 {
+				columns = append(columns, field.DBName)
+			}
+			values[i] = append(values[i], value)
+		}
+	}
+	return columns, values
+}
+
+// copyRows loads values with COPY FROM STDIN, in a transaction of its own unless
+// db is one.
+func copyRows(ctx context.Context, db *gorm.DB, table string, columns []string, values [][]interface{}) (n int64, err error) {
+	tx, ok := db.CommonDB().(*sql.Tx)
+	if !ok {
+		sqlDB, ok := db.CommonDB().(*sql.DB)
+		if !ok {
+			return 0, errors.New("bulk insert: unexpected database handle")
+		}
+		if tx, err = sqlDB.BeginTx(ctx, nil); err != nil {
+			return 0, err
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback()
+				return
+			}
+			if err = tx.Commit(); err != nil {
+				n = 0
+			}
+		}()
+	}
+
+	copyIn := pq.CopyIn(table, columns...)
+	if schema, name, ok := strings.Cut(table, "."); ok {
+		copyIn = pq.CopyInSchema(schema, name, columns...)
+	}
+	stmt, err := tx.PrepareContext(ctx, copyIn)
+	if err != nil {
+		return 0, fmt.Errorf("bulk copy: %w", err)
+	}
+	defer stmt.Close()
+	for _, row := range values {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return 0, fmt.Errorf("bulk copy: %w", err)
+		}
+	}
+	// The final Exec flushes the rows.
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return 0, fmt.Errorf("bulk copy: %w", err)
+	}
+	return int64(len(values)), nil
+}
@@ -0,0 +1,160 @@
+package goutils
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+)
+
+// rotatingConnector opens connections with the current DSN, so that a pool keeps
+// working when its credentials rotate. Connections opened with an earlier DSN
+// are dropped by database/sql instead of being reused.
+type rotatingConnector struct {
+	driver driver.Driver
+
+	mu         sync.RWMutex
+	dsn        string
+	generation uint64
+}
+
+// newRotatingConnector looks up the driver registered as driverName.
+func newRotatingConnector(driverName, dsn string) (*rotatingConnector, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return &rotatingConnector{driver: db.Driver(), dsn: dsn}, nil
+}
+
+// setDSN makes new connections use dsn and marks the existing ones as stale.
+func (c *rotatingConnector) setDSN(dsn string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dsn = dsn
+	c.generation++
+}
+
+func (c *rotatingConnector) current() (string, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dsn, c.generation
+}
+
+func (c *rotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn, generation := c.current()
+	conn, err := connectDSN(ctx, c.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &rotatingConn{Conn: conn, connector: c, generation: generation}, nil
+}
+
+func (c *rotatingConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// ping checks that dsn works with a dedicated connection.
+func (c *rotatingConnector) ping(ctx context.Context, dsn string) error {
+	conn, err := connectDSN(ctx, c.driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if pinger, ok := conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func connectDSN(ctx context.Context, d driver.Driver, dsn string) (driver.Conn, error) {
+	if dc, ok := d.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+	return d.Open(dsn)
+}
+
+// rotatingConn forwards to the driver connection. database/sql looks the
+// optional interfaces up on the connection it is given, so they are all
+// implemented here and fall back to what database/sql does without them.
+type rotatingConn struct {
+	driver.Conn
+	connector  *rotatingConnector
+	generation uint64
+}
+
+func (c *rotatingConn) stale() bool {
+	_, generation := c.connector.current()
+	return generation != c.generation
+}
+
+func (c *rotatingConn) IsValid() bool {
+	if c.stale() {
+		return false
+	}
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *rotatingConn) ResetSession(ctx context.Context) error {
+	if c.stale() {
+		return driver.ErrBadConn
+	}
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *rotatingConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *rotatingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support non-default transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *rotatingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *rotatingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := c.Conn.(driver.ExecerContext); ok {
+		return execer.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *rotatingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if queryer, ok := c.Conn.(driver.QueryerContext); ok {
+		return queryer.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *rotatingConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
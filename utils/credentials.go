@@ -0,0 +1,124 @@
+package goutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// readCredential returns the trimmed content of file, or else the value of the
+// env variable. ok is false when neither source is configured. An empty value is
+// an error, as the source is likely not populated yet.
+func readCredential(file, env string) (value string, ok bool, err error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, err
+		}
+		if value = strings.TrimSpace(string(data)); value == "" {
+			return "", false, fmt.Errorf("file %s is empty", file)
+		}
+		return value, true, nil
+	}
+	if env != "" {
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			return "", false, fmt.Errorf("environment variable %s is not set", env)
+		}
+		if value = strings.TrimSpace(value); value == "" {
+			return "", false, fmt.Errorf("environment variable %s is empty", env)
+		}
+		return value, true, nil
+	}
+	return "", false, nil
+}
+
+// DB returns the pool opened by Connect, or nil.
+func (c *DBConn) DB() *gorm.DB {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.db
+}
+
+// ReloadCredentials re-reads the DSN and password sources and, if they changed,
+// checks the new credentials with a dedicated connection and switches the pool
+// to them. The pool itself is kept, so handles obtained from Connect, DB or the
+// helpers built on them stay valid: new connections use the new credentials and
+// connections opened with the previous ones are closed once released. If the new
+// credentials do not work the pool keeps the current ones and the error is
+// returned. Replicas opened by ConnectReplicated are reloaded too. It reports
+// whether the credentials of the primary were rotated.
+func (c *DBConn) ReloadCredentials(ctx context.Context) (bool, error) {
+	rotated, err := c.reloadCredentials(ctx)
+	errs := []error{err}
+
+	c.mu.Lock()
+	replicas := c.replicas
+	c.mu.Unlock()
+	for _, replica := range replicas {
+		if replica.DB() == nil {
+			// Connect reads the current credentials once the replica is reachable.
+			continue
+		}
+		if _, err := replica.reloadCredentials(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("replica %s: %w", metricsName(replica.dbConfig), err))
+		}
+	}
+	return rotated, errors.Join(errs...)
+}
+
+func (c *DBConn) reloadCredentials(ctx context.Context) (bool, error) {
+	c.mu.Lock()
+	current, connector, connectedDSN := c.db, c.connector, c.connectedDSN
+	c.mu.Unlock()
+	if current == nil {
+		return false, errors.New("reloading credentials: not connected")
+	}
+
+	dsn, err := c.dsn()
+	if err != nil {
+		c.logger.WithError(err).Error("failed to read rotated database credentials")
+		return false, err
+	}
+	if dsn == connectedDSN {
+		return false, nil
+	}
+
+	c.logger.Info("database credentials changed, validating them")
+	if err := connector.ping(ctx, dsn); err != nil {
+		c.logger.WithError(err).Error("rotated database credentials are invalid, keeping the current ones")
+		return false, fmt.Errorf("validating rotated credentials: %w", err)
+	}
+
+	c.mu.Lock()
+	if c.db != current {
+		// Connect or Close ran meanwhile.
+		c.mu.Unlock()
+		return false, nil
+	}
+	connector.setDSN(dsn)
+	c.connectedDSN = dsn
+	c.mu.Unlock()
+	c.logger.Info("rotated database credentials")
+	return true, nil
+}
+
+// WatchCredentials calls ReloadCredentials every interval until ctx is done,
+// e.g. to follow a password mounted from a Kubernetes secret.
+func (c *DBConn) WatchCredentials(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.ReloadCredentials(ctx)
+		}
+	}
+}
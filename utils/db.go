@@ -1,22 +1,30 @@
 package goutils
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"io/fs"
+	"net"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/dlmiddlecote/sqlstats"
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/sirupsen/logrus"
 )
 
+// sqlitePackage registers the sqlite3 driver and its migrations. It is kept out
+// of this package since go-sqlite3 requires cgo.
+const sqlitePackage = "github.com/RamanPndy/go-utils/utils/sqlite"
+
 const (
 	HOTLOADDBType = "hotload"
 	POSTGRESQL    = "postgres"
@@ -25,19 +33,60 @@ const (
 )
 
 type DatabaseConfig struct {
-	Type            string
-	Address         string
-	Port            int
-	User            string
-	Password        string
-	Name            string
-	SSL             string
-	DSN             string
-	LogMode         bool
-	MaxOpenConns    int
-	MaxIdleConns    int
-	MaxConnLifetime time.Duration
-	MaxConnIdleTime time.Duration
+	Type     string `json:"type" env:"TYPE"`
+	Address  string `json:"address" env:"ADDRESS"`
+	Port     int    `json:"port" env:"PORT"`
+	User     string `json:"user" env:"USER"`
+	Password string `json:"password" env:"PASSWORD"`
+	Name     string `json:"name" env:"NAME"`
+	SSL      string `json:"ssl" env:"SSL"`
+	DSN      string `json:"dsn" env:"DSN"`
+	LogMode  bool   `json:"logMode" env:"LOG_MODE"`
+	// The pool settings default to DefaultMaxOpenConns and friends when zero, and
+	// to a single connection that never expires for SQLite.
+	//
+	// The SQLite default of MaxOpenConns = 1 serializes all queries, including
+	// reads, so that writers never fail with "database is locked" and in-memory
+	// databases are not dropped with an idle connection. Raise it for read-heavy
+	// file databases, which then must tolerate busy errors.
+	MaxOpenConns    int           `json:"maxOpenConns" env:"MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `json:"maxIdleConns" env:"MAX_IDLE_CONNS"`
+	MaxConnLifetime time.Duration `json:"maxConnLifetime" env:"MAX_CONN_LIFETIME"`
+	MaxConnIdleTime time.Duration `json:"maxConnIdleTime" env:"MAX_CONN_IDLE_TIME"`
+	// MigrationsPath is the directory holding SQL migrations. Defaults to "migrations".
+	MigrationsPath string `json:"migrationsPath" env:"MIGRATIONS_PATH"`
+	// MigrationsFS, when set, holds the migrations instead of the local disk;
+	// MigrationsPath is then resolved inside it.
+	MigrationsFS fs.FS `json:"-"`
+	// Replicas are read-only copies of the database used by ConnectReplicated.
+	Replicas []ReplicaConfig `json:"replicas"`
+	// ReplicaPolicy selects how reads are balanced across replicas:
+	// ReplicaRoundRobin (default) or ReplicaLeastConnections.
+	ReplicaPolicy string `json:"replicaPolicy" env:"REPLICA_POLICY"`
+	// ReplicaHealthCheckInterval is how often replicas are checked. Defaults to 10 seconds.
+	ReplicaHealthCheckInterval time.Duration `json:"replicaHealthCheckInterval" env:"REPLICA_HEALTH_CHECK_INTERVAL"`
+	// MetricsName is the db_name label of the pool and query metrics. Defaults to Name.
+	// Replicas are labelled with a -replica-N suffix.
+	MetricsName string `json:"metricsName" env:"METRICS_NAME"`
+	// MetricsNamespace prefixes the query metrics, e.g. "myapp" for myapp_db_query_duration_seconds.
+	MetricsNamespace string `json:"metricsNamespace" env:"METRICS_NAMESPACE"`
+	// MetricsLabels are constant labels added to all metrics.
+	MetricsLabels map[string]string `json:"metricsLabels" env:"METRICS_LABELS"`
+	// MetricsRegisterer receives the metrics. Defaults to prometheus.DefaultRegisterer.
+	MetricsRegisterer prometheus.Registerer `json:"-"`
+	// SlowQueryThreshold is the duration above which a query counts as slow.
+	// Defaults to DefaultSlowQueryThreshold.
+	SlowQueryThreshold time.Duration `json:"slowQueryThreshold" env:"SLOW_QUERY_THRESHOLD"`
+	// DSNFile and DSNEnv name a file or an environment variable holding the DSN,
+	// taking precedence over DSN. PasswordFile and PasswordEnv likewise hold the
+	// password used to build the DSN. They are re-read by WatchCredentials.
+	DSNFile      string `json:"dsnFile" env:"DSN_FILE"`
+	DSNEnv       string `json:"dsnEnv" env:"DSN_ENV"`
+	PasswordFile string `json:"passwordFile" env:"PASSWORD_FILE"`
+	PasswordEnv  string `json:"passwordEnv" env:"PASSWORD_ENV"`
+	// QueryLog enables structured query logging on connect, through the DBConn
+	// logger unless QueryLog.Logger is set. See EnableQueryLogging.
+	QueryLog *QueryLogOptions `json:"-"`
 }
 
 type DBConnInterface interface {
@@ -57,9 +106,20 @@ type DBConnInterface interface {
 	IsDBSupported() bool
 }
 
+var _ DBConnInterface = (*DBConn)(nil)
+
 type DBConn struct {
 	dbConfig *DatabaseConfig
 	logger   *logrus.Logger
+
+	mu           sync.Mutex
+	db           *gorm.DB
+	connectedDSN string
+	connector    *rotatingConnector
+	// replicas are the connections opened by ConnectReplicated.
+	replicas []*DBConn
+	// stats is the pool stats collector registered by this DBConn.
+	stats prometheus.Collector
 }
 
 func NewDBConn(dbConfig *DatabaseConfig, logger *logrus.Logger) (*DBConn, error) {
@@ -69,15 +129,87 @@ func NewDBConn(dbConfig *DatabaseConfig, logger *logrus.Logger) (*DBConn, error)
 	}, nil
 }
 
+// Connect opens a connection pool for the configured database. The DSN is taken
+// from DatabaseConfig.DSN when set and built from the other fields otherwise.
+// Ready, IsReady and WaitReady then check the database through this pool.
+// SQLite requires importing the github.com/RamanPndy/go-utils/utils/sqlite
+// package.
+//
+// Calling Connect again returns the same pool until it is passed to Close, so
+// closing one of the returned handles closes them all. Earlier versions opened
+// a new pool on each call; callers relying on that must use a DBConn per pool.
 func (c *DBConn) Connect() (*gorm.DB, error) {
-	db, err := new(c.dbConfig, c.logger)
+	if db := c.DB(); db != nil {
+		return db, nil
+	}
+	dsn, err := c.dsn()
+	if err != nil {
+		c.logger.WithError(err).Error("failed to build database dsn")
+		return nil, err
+	}
+	db, connector, err := c.open(dsn)
 	if err != nil {
 		return nil, err
 	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db != nil {
+		// Lost a race with a concurrent Connect.
+		db.Close()
+		return c.db, nil
+	}
+	c.db, c.connector, c.connectedDSN = db, connector, dsn
 	return db, nil
 }
 
+// open opens a pool whose connections use the DSN of the returned connector,
+// which ReloadCredentials updates.
+func (c *DBConn) open(dsn string) (*gorm.DB, *rotatingConnector, error) {
+	if c.IsHotload() {
+		if err := setupGormWithHotload(dsn); err != nil {
+			c.logger.WithError(err).Error("failed to register hotload dialect")
+			return nil, nil, err
+		}
+	}
+
+	dbType := strings.TrimSpace(c.dbConfig.Type)
+	connector, err := newRotatingConnector(dbType, dsn)
+	if err != nil {
+		c.logger.WithError(err).Error("failed to open database connection")
+		return nil, nil, err
+	}
+	sqlDB := sql.OpenDB(connector)
+	db, err := gorm.Open(dbType, sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		c.logger.WithError(err).Error("failed to open database connection")
+		return nil, nil, err
+	}
+	db.SetLogger(c.logger)
+	configureDBConns(db, c.dbConfig)
+	c.mu.Lock()
+	c.stats = registerDBMetrics(c.logger, db, c.dbConfig, c.stats)
+	c.mu.Unlock()
+	if c.dbConfig.QueryLog != nil {
+		opts := *c.dbConfig.QueryLog
+		if opts.Logger == nil {
+			opts.Logger = &Logger{c.logger}
+		}
+		if opts.SlowThreshold <= 0 {
+			opts.SlowThreshold = c.dbConfig.SlowQueryThreshold
+		}
+		EnableQueryLogging(db, &opts)
+	}
+	return db, connector, nil
+}
+
 func (c *DBConn) Close(db *gorm.DB) error {
+	c.mu.Lock()
+	if c.db == db {
+		c.db, c.connector = nil, nil
+	}
+	c.mu.Unlock()
 	if db != nil {
 		if err := db.Close(); err != nil {
 			c.logger.WithError(err).Error("failed to close database connection")
@@ -87,120 +219,133 @@ func (c *DBConn) Close(db *gorm.DB) error {
 	return nil
 }
 
-func new(dbConfig *DatabaseConfig, logger *logrus.Logger) (*gorm.DB, error) {
-	dbType := strings.TrimSpace(dbConfig.Type)
-
-	if strings.TrimSpace(dbConfig.DSN) == "" {
-		logger.Error("database.dsn is required")
-		return nil, fmt.Errorf("database.dsn is required")
+// dsn returns the DSN from its file or environment source, the explicit DSN, or
+// one built from the configuration fields, in that order.
+func (c *DBConn) dsn() (string, error) {
+	if dsn, ok, err := readCredential(c.dbConfig.DSNFile, c.dbConfig.DSNEnv); err != nil {
+		return "", fmt.Errorf("reading dsn: %w", err)
+	} else if ok {
+		return dsn, nil
 	}
-
-	var (
-		db  *gorm.DB
-		err error
-	)
-	if dbType == HOTLOADDBType {
-		if err := setupGormWithHotload(dbConfig); err != nil {
-			return nil, err
-		}
-
+	if dsn := strings.TrimSpace(c.dbConfig.DSN); dsn != "" {
+		return dsn, nil
 	}
-	db, err = gorm.Open(dbType, dbConfig.DSN)
-	if err != nil {
-		logger.WithError(err).Error("failed to open database connection")
-		return nil, err
+
+	dbConfig := c.dbConfig
+	if password, ok, err := readCredential(c.dbConfig.PasswordFile, c.dbConfig.PasswordEnv); err != nil {
+		return "", fmt.Errorf("reading password: %w", err)
+	} else if ok {
+		withPassword := *c.dbConfig
+		withPassword.Password = password
+		dbConfig = &withPassword
 	}
-	configureDBConns(db, dbConfig)
-	registerSQLStats(logger, db)
-	return db, nil
+	return FormatDSN(dbConfig)
 }
 
+// Ready pings the database through the connected pool, or through a temporary
+// one when Connect has not been called.
 func (c *DBConn) Ready() error {
-	db, err := sql.Open(c.dbConfig.Type, c.dbConfig.DSN)
+	return c.ping(context.Background())
+}
+
+func (c *DBConn) ping(ctx context.Context) error {
+	db, release, err := c.sqlDB()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	defer release()
+	return db.PingContext(ctx)
+}
+
+// sqlDB returns the connected pool, or a new one that release closes.
+func (c *DBConn) sqlDB() (*sql.DB, func(), error) {
+	c.mu.Lock()
+	connected := c.db
+	c.mu.Unlock()
+	if connected != nil {
+		return connected.DB(), func() {}, nil
+	}
 
-	return db.Ping()
+	dsn, err := c.dsn()
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := sql.Open(c.dbConfig.Type, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, func() { db.Close() }, nil
 }
 
 func (c *DBConn) Migrate(db *gorm.DB, models ...interface{}) error {
 	return db.AutoMigrate(models...).Error
 }
 
+// Rollback rolls back the last migration found in DatabaseConfig.MigrationsPath.
 func (c *DBConn) Rollback(db *gorm.DB) error {
-	return db.Close()
+	m, err := c.NewMigrator()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	return m.Down(1)
 }
 
+// MigrateFromPath applies all pending migrations found in migrationsPath.
 func (c *DBConn) MigrateFromPath(db *gorm.DB, migrationsPath string) error {
-	m, err := migrate.New(
-		fmt.Sprintf("file://%s", migrationsPath),
-		c.dbConfig.DSN,
-	)
+	m, err := c.NewMigratorFromPath(migrationsPath)
 	if err != nil {
-		c.logger.Errorf("Run : initializing migrator: %v", err)
-		return fmt.Errorf("initializing migrator: %w", err)
+		return err
 	}
-	defer func() {
-		_, err = m.Close()
-		if err != nil {
-			c.logger.Errorf("closing migrator: %v", err)
-		}
-	}()
+	defer m.Close()
+	return m.Up()
+}
+
+// RollbackFromPath rolls back the last migration found in migrationsPath.
+func (c *DBConn) RollbackFromPath(db *gorm.DB, migrationsPath string) error {
+	return c.RollbackStepsFromPath(db, migrationsPath, 1)
+}
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		c.logger.Errorf("running migrations: %v", err)
-		return fmt.Errorf("running migrations: %w", err)
+// RollbackStepsFromPath rolls back the last steps migrations found in
+// migrationsPath. steps must be at least 1.
+func (c *DBConn) RollbackStepsFromPath(db *gorm.DB, migrationsPath string, steps int) error {
+	m, err := c.NewMigratorFromPath(migrationsPath)
+	if err != nil {
+		return err
 	}
-	return nil
+	defer m.Close()
+	return m.Down(steps)
 }
 
-func (c *DBConn) RollbackFromPath(db *gorm.DB, migrationsPath string, steps int) error {
-	m, err := migrate.New(
-		fmt.Sprintf("file://%s", migrationsPath),
-		c.dbConfig.DSN,
-	)
+// MigrateFromFS applies all pending migrations found in dir inside fsys.
+func (c *DBConn) MigrateFromFS(db *gorm.DB, fsys fs.FS, dir string) error {
+	m, err := c.NewMigratorFromFS(fsys, dir)
 	if err != nil {
-		c.logger.Errorf("Run : initializing migrator: %v", err)
-		return fmt.Errorf("initializing migrator: %w", err)
+		return err
 	}
-	defer func() {
-		_, err = m.Close()
-		if err != nil {
-			c.logger.Errorf("closing migrator: %v", err)
-		}
-	}()
+	defer m.Close()
+	return m.Up()
+}
 
-	if steps != 0 {
-		if err := m.Steps(-steps); err != nil && err != migrate.ErrNoChange {
-			c.logger.Errorf("running rollback migrations: %v", err)
-			return fmt.Errorf("running rollback migrations: %w", err)
-		}
-	} else {
-		if err := m.Down(); err != nil && err != migrate.ErrNoChange {
-			c.logger.Errorf("running rollback migrations: %v", err)
-			return fmt.Errorf("running rollback migrations: %w", err)
-		}
+// RollbackFromFS rolls back the last steps migrations found in dir inside fsys.
+// steps must be at least 1.
+func (c *DBConn) RollbackFromFS(db *gorm.DB, fsys fs.FS, dir string, steps int) error {
+	m, err := c.NewMigratorFromFS(fsys, dir)
+	if err != nil {
+		return err
 	}
-	return nil
+	defer m.Close()
+	return m.Down(steps)
 }
 
+// Version returns the current migration version of the database, suffixed with
+// " (dirty)" when the last migration failed.
 func (c *DBConn) Version(db *gorm.DB) (string, error) {
-	m, err := migrate.New(
-		fmt.Sprintf("file://%s", "migrations"),
-		c.dbConfig.DSN,
-	)
+	m, err := c.NewMigrator()
 	if err != nil {
-		c.logger.Errorf("Run : initializing migrator: %v", err)
-		return "", fmt.Errorf("initializing migrator: %w", err)
+		return "", err
 	}
-	defer func() {
-		_, err = m.Close()
-		if err != nil {
-			c.logger.Errorf("closing migrator: %v", err)
-		}
-	}()
+	defer m.Close()
 
 	version, dirty, err := m.Version()
 	if err != nil {
@@ -222,8 +367,13 @@ func (c *DBConn) IsHotload() bool {
 	return c.dbConfig.Type == HOTLOADDBType
 }
 
+// GetDSN returns the DSN used to connect, or an empty string if it cannot be built.
 func (c *DBConn) GetDSN() string {
-	return c.dbConfig.DSN
+	dsn, err := c.dsn()
+	if err != nil {
+		return ""
+	}
+	return dsn
 }
 
 func (c *DBConn) GetDBType() string {
@@ -231,14 +381,7 @@ func (c *DBConn) GetDBType() string {
 }
 
 func (c *DBConn) IsReady() bool {
-	db, err := sql.Open(c.dbConfig.Type, c.dbConfig.DSN)
-	if err != nil {
-		c.logger.WithError(err).Error("failed to open database connection")
-		return false
-	}
-	defer db.Close()
-
-	if err := db.Ping(); err != nil {
+	if err := c.Ready(); err != nil {
 		c.logger.WithError(err).Error("database ping failed")
 		return false
 	}
@@ -255,88 +398,130 @@ func (c *DBConn) IsDBSupported() bool {
 	return false
 }
 
-// registerSQLStats exposes database/sql pool stats as go_sql_stats_connections_* metrics.
-// It is idempotent: a duplicate registration is silently ignored.
-func registerSQLStats(logger *logrus.Logger, db *gorm.DB) {
-	collector := sqlstats.NewStatsCollector("axur_integrator", db.DB())
-	if err := prometheus.Register(collector); err != nil {
-		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
-			logger.WithError(err).Warn("failed to register sqlstats collector")
-		}
-	}
-}
-
-// configureDBConns sets the db connection string
+// configureDBConns applies the log mode and pool settings, with defaults for
+// the zero ones.
 func configureDBConns(db *gorm.DB, dbConfig *DatabaseConfig) {
 	db.LogMode(dbConfig.LogMode)
-	db.DB().SetMaxOpenConns(dbConfig.MaxOpenConns)
-	db.DB().SetMaxIdleConns(dbConfig.MaxIdleConns)
-	db.DB().SetConnMaxLifetime(dbConfig.MaxConnLifetime)
-	db.DB().SetConnMaxIdleTime(dbConfig.MaxConnIdleTime)
+	pool := poolSettingsFor(dbConfig)
+	db.DB().SetMaxOpenConns(pool.maxOpen)
+	db.DB().SetMaxIdleConns(pool.maxIdle)
+	db.DB().SetConnMaxLifetime(pool.maxLifetime)
+	db.DB().SetConnMaxIdleTime(pool.maxIdleTime)
 }
 
-func setupGormWithHotload(dbConfig *DatabaseConfig) error {
-	if dbType := dbConfig.Type; dbType == HOTLOADDBType {
-		u, err := url.Parse(dbConfig.DSN)
-		if err != nil {
-			return fmt.Errorf("could not parse hotload dsn, it must be an URL in case if hotload is enabled: %w", err)
-		}
-		// hostname in hotload URLs contains the name of the underlying driver
-		dialect, ok := gorm.GetDialect(u.Hostname())
-		if !ok {
-			return fmt.Errorf("could not find underlying dialect %v", u.Hostname())
-		}
-		gorm.RegisterDialect(dbType, dialect)
+// setupGormWithHotload registers the hotload dialect with gorm. This must be
+// called before gorm.Open when database.type is "hotload". The DSN is expected
+// to be a URL like "hotload://postgres/..." where the hostname is the underlying
+// driver name.
+func setupGormWithHotload(dsn string) error {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return fmt.Errorf("could not parse hotload dsn, it must be an URL in case if hotload is enabled: %w", err)
+	}
+	// hostname in hotload URLs contains the name of the underlying driver
+	dialect, ok := gorm.GetDialect(u.Hostname())
+	if !ok {
+		return fmt.Errorf("could not find underlying dialect %v", u.Hostname())
 	}
+	gorm.RegisterDialect(HOTLOADDBType, dialect)
 	return nil
 }
 
+// BuildDSN builds the driver-specific connection string for dbConfig, or returns
+// an empty string when it cannot be built. See FormatDSN for the error.
 func BuildDSN(dbConfig *DatabaseConfig) string {
-	return fmt.Sprintf("host=%s port=%d user=%s password=%s sslmode=%s dbname=%s",
-		dbConfig.Address, dbConfig.Port,
-		dbConfig.User, dbConfig.Password,
-		dbConfig.SSL, dbConfig.Name)
+	dsn, _ := FormatDSN(dbConfig)
+	return dsn
 }
 
-func OpenDB(dbConfig *DatabaseConfig, logger *logrus.Logger) (*gorm.DB, error) {
-	// For hotload, register the dialect before gorm.Open (same as grpcserver.setupGormWithHotload).
-	var (
-		dbType string
-		dsn    string
-	)
-
-	if dbConfig.Type == HOTLOADDBType {
-		if err := registerHotloadDialect(dbConfig.DSN); err != nil {
-			return nil, err
+// FormatDSN builds the driver-specific connection string for dbConfig from its
+// Address, Port, User, Password, Name and SSL fields. Values are escaped as
+// required by each driver. Hotload connections have no such form and must set
+// DatabaseConfig.DSN instead.
+func FormatDSN(dbConfig *DatabaseConfig) (string, error) {
+	switch strings.TrimSpace(dbConfig.Type) {
+	case POSTGRESQL:
+		return buildPostgresDSN(dbConfig), nil
+	case MYSQL:
+		return buildMySQLDSN(dbConfig)
+	case SQLITE3:
+		if dbConfig.Name == "" {
+			return "", fmt.Errorf("database.name is required for %s", SQLITE3)
 		}
-	} else {
-		dsn = BuildDSN(dbConfig)
+		return dbConfig.Name, nil
+	case HOTLOADDBType:
+		return "", fmt.Errorf("database.dsn is required for %s", HOTLOADDBType)
+	default:
+		return "", fmt.Errorf("unsupported database type %q", dbConfig.Type)
 	}
+}
 
-	database, err := gorm.Open(dbType, dsn)
-	if err != nil {
-		return nil, fmt.Errorf("openDB: %w", err)
+func buildPostgresDSN(dbConfig *DatabaseConfig) string {
+	var pairs []string
+	add := func(key, value string) {
+		if value != "" {
+			pairs = append(pairs, key+"="+quotePostgresValue(value))
+		}
+	}
+	add("host", dbConfig.Address)
+	if dbConfig.Port > 0 {
+		add("port", strconv.Itoa(dbConfig.Port))
 	}
-	database.SetLogger(logger)
-	configureDBConns(database, dbConfig)
-	registerSQLStats(logger, database)
+	add("user", dbConfig.User)
+	add("password", dbConfig.Password)
+	add("dbname", dbConfig.Name)
+	add("sslmode", dbConfig.SSL)
+	return strings.Join(pairs, " ")
+}
 
-	return database, nil
+// quotePostgresValue quotes a keyword/value connection string value when it
+// contains characters that would otherwise end or escape it.
+func quotePostgresValue(value string) string {
+	if !strings.ContainsAny(value, " '\\\t\n") {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
 }
 
-// registerHotloadDialect registers the hotload dialect with gorm. This must be
-// called before gorm.Open when database.type is "hotload". The DSN is expected
-// to be a URL like "hotload://postgres/..." where the hostname is the underlying
-// driver name.
-func registerHotloadDialect(dsn string) error {
-	u, err := url.Parse(dsn)
+func buildMySQLDSN(dbConfig *DatabaseConfig) (string, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = dbConfig.User
+	cfg.Passwd = dbConfig.Password
+	cfg.Net = "tcp"
+	port := dbConfig.Port
+	if port == 0 {
+		port = 3306
+	}
+	cfg.Addr = net.JoinHostPort(dbConfig.Address, strconv.Itoa(port))
+	cfg.DBName = dbConfig.Name
+	cfg.ParseTime = true
+
+	// Accept the postgres sslmode vocabulary so that configs stay portable.
+	switch strings.ToLower(dbConfig.SSL) {
+	case "", "disable", "false":
+	case "require", "skip-verify":
+		cfg.TLSConfig = "skip-verify"
+	case "verify-ca", "verify-full", "true":
+		cfg.TLSConfig = "true"
+	case "prefer", "preferred", "allow":
+		cfg.TLSConfig = "preferred"
+	default:
+		return "", fmt.Errorf("unsupported ssl mode %q for %s", dbConfig.SSL, MYSQL)
+	}
+	return cfg.FormatDSN(), nil
+}
+
+// OpenDB opens dbConfig through a DBConn. See DBConn.Connect.
+func OpenDB(dbConfig *DatabaseConfig, logger *logrus.Logger) (*gorm.DB, error) {
+	conn, err := NewDBConn(dbConfig, logger)
 	if err != nil {
-		return fmt.Errorf("could not parse hotload dsn: %w", err)
+		return nil, err
 	}
-	dialect, ok := gorm.GetDialect(u.Hostname())
-	if !ok {
-		return fmt.Errorf("could not find underlying dialect %v", u.Hostname())
+	database, err := conn.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("openDB: %w", err)
 	}
-	gorm.RegisterDialect("hotload", dialect)
-	return nil
+	return database, nil
 }
@@ -0,0 +1,270 @@
+// Package dbtest creates isolated SQLite databases for tests, with migrations,
+// models and fixtures. It imports the sqlite package, and so requires cgo.
+package dbtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	_ "github.com/RamanPndy/go-utils/utils/sqlite"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Options configures New. A nil *Options gives an empty database.
+type Options struct {
+	// InMemory uses an in-memory database rather than a file in t.TempDir().
+	InMemory bool
+	// MigrationsPath is the directory of the migrations to apply, inside
+	// MigrationsFS when it is set.
+	MigrationsPath string
+	MigrationsFS   fs.FS
+	// Models are auto-migrated after the migrations.
+	Models []interface{}
+	// Fixtures are YAML or JSON files loaded after the migrations, read from
+	// FixturesFS when it is set. See LoadFixtures.
+	Fixtures   []string
+	FixturesFS fs.FS
+	// Logger defaults to a logger discarding everything but errors.
+	Logger *logrus.Logger
+}
+
+// DB is an isolated SQLite database for a test.
+type DB struct {
+	Conn *goutils.DBConn
+	// DB is the connected pool. Use Tx to make changes that are rolled back.
+	DB *gorm.DB
+}
+
+var testDBCount atomic.Int64
+
+// New creates a SQLite database for t with the migrations, models and fixtures
+// of opts, and closes it when t ends. Setup errors fail the test.
+func New(t testing.TB, opts *Options) *DB {
+	t.Helper()
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Logger == nil {
+		o.Logger = logrus.New()
+		o.Logger.SetLevel(logrus.ErrorLevel)
+	}
+
+	dbConfig := &goutils.DatabaseConfig{
+		Type:           goutils.SQLITE3,
+		Name:           filepath.Join(t.TempDir(), "test.db"),
+		MigrationsPath: o.MigrationsPath,
+		MigrationsFS:   o.MigrationsFS,
+		// Beyond the single SQLite default, so that DB can be queried while a Tx
+		// holds a connection, and an in-memory database is kept alive by one.
+		MaxOpenConns: 4,
+	}
+	if o.InMemory {
+		// Unlike ":memory:", a named shared-cache database is seen by all connections,
+		// including the one of the migrations, and is distinct from those of other tests.
+		name := fmt.Sprintf("testdb_%d", testDBCount.Add(1))
+		dbConfig.Name = fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(name))
+	}
+	conn, err := goutils.NewDBConn(dbConfig, o.Logger)
+	if err != nil {
+		t.Fatalf("creating test database: %v", err)
+	}
+	db, err := conn.Connect()
+	if err != nil {
+		t.Fatalf("creating test database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close(db) })
+	if o.InMemory {
+		// Keep the database alive even if the pool closes its idle connections.
+		keepAlive, err := db.DB().Conn(context.Background())
+		if err != nil {
+			t.Fatalf("creating test database: %v", err)
+		}
+		t.Cleanup(func() { keepAlive.Close() })
+	}
+
+	if o.MigrationsPath != "" {
+		m, err := conn.NewMigrator()
+		if err != nil {
+			t.Fatalf("migrating test database: %v", err)
+		}
+		err = m.Up()
+		m.Close()
+		if err != nil {
+			t.Fatalf("migrating test database: %v", err)
+		}
+	}
+	if len(o.Models) > 0 {
+		if err := db.AutoMigrate(o.Models...).Error; err != nil {
+			t.Fatalf("migrating test database: %v", err)
+		}
+	}
+	if err := LoadFixtures(db, o.FixturesFS, o.Fixtures...); err != nil {
+		t.Fatalf("loading fixtures: %v", err)
+	}
+	return &DB{Conn: conn, DB: db}
+}
+
+// Tx begins a transaction that is rolled back when t ends, so that the changes
+// of a test do not leak into the next. Queries on d.DB do not see its changes,
+// and since SQLite allows a single writer, writing through d.DB fails while it
+// is open, as do parallel tests using transactions of the same DB.
+func (d *DB) Tx(t testing.TB) *gorm.DB {
+	t.Helper()
+	tx := d.DB.Begin()
+	if tx.Error != nil {
+		t.Fatalf("beginning test transaction: %v", tx.Error)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+// LoadFixtures inserts the rows of YAML or JSON fixture files, read from fsys or
+// from the file system when it is nil. Each file maps table names to lists of
+// rows, and tables are loaded in the order of the file, parents before the
+// children referencing them:
+//
+//	users:
+//	  - id: 1
+//	    email: ann@example.com
+//
+// Nested objects and lists are stored as JSON.
+func LoadFixtures(db *gorm.DB, fsys fs.FS, paths ...string) error {
+	for _, path := range paths {
+		var data []byte
+		var err error
+		if fsys != nil {
+			data, err = fs.ReadFile(fsys, path)
+		} else {
+			data, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return err
+		}
+		// The tables are decoded as JSON to keep its number precision, and their
+		// order is read from the YAML mapping.
+		var order yaml.MapSlice
+		if err := yaml.Unmarshal(data, &order); err != nil {
+			return fmt.Errorf("parsing fixtures %s: %w", path, err)
+		}
+		jsonData, err := goutils.YamlToJson(data)
+		if err != nil {
+			return fmt.Errorf("parsing fixtures %s: %w", path, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(jsonData))
+		decoder.UseNumber()
+		var tables map[string][]map[string]interface{}
+		if err := decoder.Decode(&tables); err != nil {
+			return fmt.Errorf("parsing fixtures %s: %w", path, err)
+		}
+
+		for _, item := range order {
+			name := fmt.Sprint(item.Key)
+			for i, row := range tables[name] {
+				if err := insertFixture(db, name, row); err != nil {
+					return fmt.Errorf("loading fixtures %s: %s[%d]: %w", path, name, i, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func insertFixture(db *gorm.DB, table string, row map[string]interface{}) error {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	quoted := make([]string, len(columns))
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		quoted[i] = db.Dialect().Quote(column)
+		value, err := fixtureValue(row[column])
+		if err != nil {
+			return err
+		}
+		values[i] = value
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", db.Dialect().Quote(table),
+		strings.Join(quoted, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+	return db.Exec(query, values...).Error
+}
+
+func fixtureValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		f, err := v.Float64()
+		if err != nil || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("invalid number %s", v)
+		}
+		return f, nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		return string(data), err
+	default:
+		return v, nil
+	}
+}
+
+// AssertRowCount fails t unless table holds expected rows matching where, a
+// condition and its arguments as accepted by gorm's Where.
+func AssertRowCount(t testing.TB, db *gorm.DB, table string, expected int, where ...interface{}) {
+	t.Helper()
+	query := db.Table(table)
+	if len(where) > 0 {
+		query = query.Where(where[0], where[1:]...)
+	}
+	var count int
+	if err := query.Count(&count).Error; err != nil {
+		t.Errorf("counting rows of %s: %v", table, err)
+		return
+	}
+	if count != expected {
+		t.Errorf("expected %d rows in %s, got %d", expected, table, count)
+	}
+}
+
+// AssertRow fails t unless table holds a row with the given column values.
+func AssertRow(t testing.TB, db *gorm.DB, table string, values map[string]interface{}) {
+	t.Helper()
+	if count, err := countMatching(db, table, values); err != nil {
+		t.Errorf("querying %s: %v", table, err)
+	} else if count == 0 {
+		t.Errorf("expected a row in %s matching %v", table, values)
+	}
+}
+
+// AssertNoRow fails t if table holds a row with the given column values.
+func AssertNoRow(t testing.TB, db *gorm.DB, table string, values map[string]interface{}) {
+	t.Helper()
+	if count, err := countMatching(db, table, values); err != nil {
+		t.Errorf("querying %s: %v", table, err)
+	} else if count > 0 {
+		t.Errorf("expected no row in %s matching %v, got %d", table, values, count)
+	}
+}
+
+func countMatching(db *gorm.DB, table string, values map[string]interface{}) (int, error) {
+	var count int
+	err := db.Table(table).Where(values).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,74 @@
+package goutils
+
+import (
+	"context"
+	"sync"
+)
+
+// FanOutOptions controls how FanOut dispatches requests.
+type FanOutOptions struct {
+	// Concurrency bounds the number of requests in flight. Defaults to 10.
+	Concurrency int
+	// FailFast cancels the requests still pending or in flight once one fails.
+	FailFast bool
+}
+
+// FanOutResult holds the outcome of one request sent by FanOut.
+type FanOutResult struct {
+	Request *APIRequest
+	Result  *APIResult
+	Err     *APIError
+}
+
+// FanOut sends requests through api with bounded concurrency and returns one
+// result per request, in the same order as requests.
+func FanOut(ctx context.Context, api API, requests []*APIRequest, opts FanOutOptions) []FanOutResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]FanOutResult, len(requests))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, request := range requests {
+		results[i].Request = request
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = &APIError{Message: ctx.Err().Error()}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, request *APIRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := ctx.Err(); err != nil {
+				results[i].Err = &APIError{Message: err.Error()}
+				return
+			}
+			results[i].Result, results[i].Err = api.DoRequest(ctx, request)
+			if results[i].Err != nil && opts.FailFast {
+				cancel()
+			}
+		}(i, request)
+	}
+	wg.Wait()
+	return results
+}
+
+// FanOut sends requests with bounded concurrency. See the package-level FanOut.
+func (c *APIClient) FanOut(ctx context.Context, requests []*APIRequest, opts FanOutOptions) []FanOutResult {
+	return FanOut(ctx, c, requests, opts)
+}
+
+// DoHedgedRequest sends request through a throwaway HedgedClient. Since no latency
+// history is kept between calls, policy.Delay is always used; keep a HedgedClient
+// around to benefit from percentile-based delays.
+func (c *APIClient) DoHedgedRequest(ctx context.Context, request *APIRequest, policy HedgePolicy) (*APIResult, *APIError) {
+	return NewHedgedClient(c, policy).DoRequest(ctx, request)
+}
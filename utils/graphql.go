@@ -0,0 +1,201 @@
+package goutils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type GraphQLRequest struct {
+	Query         string         `json:"query,omitempty"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	Extensions    map[string]any `json:"extensions,omitempty"`
+	// PersistedQueryHash is the SHA-256 of Query registered on the server. It is
+	// computed from Query when persisted queries are enabled and left empty.
+	PersistedQueryHash string `json:"-"`
+}
+
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is one entry of the "errors" array of a GraphQL response.
+type GraphQLError struct {
+	Message    string            `json:"message"`
+	Path       []any             `json:"path,omitempty"`
+	Locations  []GraphQLLocation `json:"locations,omitempty"`
+	Extensions map[string]any    `json:"extensions,omitempty"`
+}
+
+func (e *GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (path: %s)", e.Message, e.PathString())
+}
+
+// PathString renders Path as a dotted string, e.g. "user.friends.0.name".
+func (e *GraphQLError) PathString() string {
+	parts := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		parts[i] = fmt.Sprint(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Code returns extensions.code, the conventional machine-readable error code.
+func (e *GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// GraphQLErrors is returned when a response carries errors. Data that was
+// returned alongside the errors is still decoded into the target.
+type GraphQLErrors []*GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+// GraphQLHTTPError is returned when the server answers with a non-2xx status
+// and no GraphQL errors.
+type GraphQLHTTPError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *GraphQLHTTPError) Error() string {
+	return fmt.Sprintf("graphql: unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+// GraphQLClient sends queries and mutations to a GraphQL endpoint through an API
+// such as APIClient.
+type GraphQLClient struct {
+	api              API
+	endpoint         string
+	headers          map[string]string
+	persistedQueries bool
+}
+
+func NewGraphQLClient(api API, endpoint string) *GraphQLClient {
+	return &GraphQLClient{api: api, endpoint: endpoint, headers: make(map[string]string)}
+}
+
+func (c *GraphQLClient) SetHeader(key, value string) *GraphQLClient {
+	c.headers[key] = value
+	return c
+}
+
+// EnablePersistedQueries sends query hashes instead of query documents, following
+// the automatic persisted queries protocol: when the server does not know a hash
+// the request is retried once with the full query.
+func (c *GraphQLClient) EnablePersistedQueries() *GraphQLClient {
+	c.persistedQueries = true
+	return c
+}
+
+func (c *GraphQLClient) Query(ctx context.Context, query string, variables map[string]any, target any) error {
+	return c.Do(ctx, &GraphQLRequest{Query: query, Variables: variables}, target)
+}
+
+func (c *GraphQLClient) Mutate(ctx context.Context, mutation string, variables map[string]any, target any) error {
+	return c.Do(ctx, &GraphQLRequest{Query: mutation, Variables: variables}, target)
+}
+
+// Do sends req and decodes the "data" member of the response into target, which
+// may be nil. Errors reported by the server are returned as GraphQLErrors.
+func (c *GraphQLClient) Do(ctx context.Context, req *GraphQLRequest, target any) error {
+	hash := req.PersistedQueryHash
+	if hash == "" && c.persistedQueries && req.Query != "" {
+		sum := sha256.Sum256([]byte(req.Query))
+		hash = hex.EncodeToString(sum[:])
+	}
+	if hash == "" {
+		return c.send(ctx, req, target)
+	}
+
+	persisted := *req
+	persisted.Extensions = withPersistedQuery(req.Extensions, hash)
+	persisted.Query = ""
+	err := c.send(ctx, &persisted, target)
+
+	var gqlErrs GraphQLErrors
+	if errors.As(err, &gqlErrs) && isPersistedQueryNotFound(gqlErrs) {
+		if req.Query == "" {
+			return fmt.Errorf("graphql: persisted query %s not found and no query to register: %w", hash, err)
+		}
+		persisted.Query = req.Query
+		return c.send(ctx, &persisted, target)
+	}
+	return err
+}
+
+func (c *GraphQLClient) send(ctx context.Context, req *GraphQLRequest, target any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("graphql: encode request: %w", err)
+	}
+
+	request := NewAPIRequest().SetMethod(POST).SetURL(c.endpoint).SetJSONBody(body).AddHeader("Accept", string(ApplicationJSON))
+	for key, value := range c.headers {
+		request.AddHeader(key, value)
+	}
+	result, apiErr := c.api.DoRequest(ctx, request)
+	if apiErr != nil {
+		return fmt.Errorf("graphql: %w", apiErr)
+	}
+
+	var resp graphQLResponse
+	if err := json.Unmarshal(result.BodyBytes, &resp); err != nil {
+		if result.StatusCode < 200 || result.StatusCode > 299 {
+			return &GraphQLHTTPError{StatusCode: result.StatusCode, Body: result.BodyBytes}
+		}
+		return fmt.Errorf("graphql: decode response: %w", err)
+	}
+	if len(resp.Errors) == 0 && (result.StatusCode < 200 || result.StatusCode > 299) {
+		return &GraphQLHTTPError{StatusCode: result.StatusCode, Body: result.BodyBytes}
+	}
+
+	if target != nil && len(resp.Data) > 0 && string(resp.Data) != "null" {
+		if err := json.Unmarshal(resp.Data, target); err != nil {
+			return fmt.Errorf("graphql: decode data: %w", err)
+		}
+	}
+	if len(resp.Errors) > 0 {
+		return resp.Errors
+	}
+	return nil
+}
+
+func withPersistedQuery(extensions map[string]any, hash string) map[string]any {
+	merged := make(map[string]any, len(extensions)+1)
+	for key, value := range extensions {
+		merged[key] = value
+	}
+	merged["persistedQuery"] = map[string]any{"version": 1, "sha256Hash": hash}
+	return merged
+}
+
+func isPersistedQueryNotFound(errs GraphQLErrors) bool {
+	for _, err := range errs {
+		if err.Message == "PersistedQueryNotFound" || err.Code() == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package goutils
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultHedgeDelay is the hedge delay used when HedgePolicy.Delay is zero.
+const DefaultHedgeDelay = 100 * time.Millisecond
+
+// HedgePolicy controls when HedgedClient sends duplicate requests.
+type HedgePolicy struct {
+	// Percentile of recently observed latencies after which a hedge is sent, e.g. 0.95.
+	Percentile float64
+	// Delay is used until MinSamples latencies have been observed. Defaults to
+	// DefaultHedgeDelay.
+	Delay time.Duration
+	// MinDelay and MaxDelay clamp the percentile-based delay. Zero means no bound.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// MaxHedges is the number of additional requests that may be sent. Defaults to 1.
+	MaxHedges int
+	// WindowSize is the number of recent latencies kept. Defaults to 100.
+	WindowSize int
+	// MinSamples is the number of latencies required before the percentile is trusted. Defaults to 10.
+	MinSamples int
+	// HedgeUnsafeMethods allows hedging methods other than GET, HEAD and OPTIONS.
+	HedgeUnsafeMethods bool
+}
+
+// HedgedClient sends a second copy of a request when the first has not answered
+// within a percentile of recently observed latencies. The first response wins and
+// the remaining in-flight requests are cancelled.
+type HedgedClient struct {
+	api     API
+	policy  HedgePolicy
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func NewHedgedClient(api API, policy HedgePolicy) *HedgedClient {
+	if policy.Delay <= 0 {
+		policy.Delay = DefaultHedgeDelay
+	}
+	if policy.MaxHedges <= 0 {
+		policy.MaxHedges = 1
+	}
+	if policy.WindowSize <= 0 {
+		policy.WindowSize = 100
+	}
+	if policy.MinSamples <= 0 {
+		policy.MinSamples = 10
+	}
+	if policy.Percentile <= 0 || policy.Percentile > 1 {
+		policy.Percentile = 0.95
+	}
+	return &HedgedClient{api: api, policy: policy}
+}
+
+type hedgeResult struct {
+	result  *APIResult
+	err     *APIError
+	elapsed time.Duration
+}
+
+func (h *HedgedClient) DoRequest(ctx context.Context, request *APIRequest) (*APIResult, *APIError) {
+	if !h.policy.HedgeUnsafeMethods && !isSafeMethod(request.Method) {
+		return h.api.DoRequest(ctx, request)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	attempts := h.policy.MaxHedges + 1
+	results := make(chan hedgeResult, attempts)
+	send := func() {
+		start := time.Now()
+		result, err := h.api.DoRequest(ctx, request)
+		results <- hedgeResult{result: result, err: err, elapsed: time.Since(start)}
+	}
+
+	go send()
+	inFlight, sent := 1, 1
+	timer := time.NewTimer(h.HedgeDelay())
+	defer timer.Stop()
+
+	var lastErr *APIError
+	for inFlight > 0 {
+		select {
+		case <-timer.C:
+			if sent < attempts {
+				go send()
+				inFlight++
+				sent++
+				timer.Reset(h.HedgeDelay())
+			}
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				h.observe(r.elapsed)
+				return r.result, nil
+			}
+			lastErr = r.err
+			// Fail over immediately instead of waiting for the hedge delay.
+			if inFlight == 0 && sent < attempts && ctx.Err() == nil {
+				go send()
+				inFlight++
+				sent++
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// HedgeDelay returns the delay after which the next hedge is sent.
+func (h *HedgedClient) HedgeDelay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delay := h.policy.Delay
+	if len(h.samples) >= h.policy.MinSamples {
+		sorted := append([]time.Duration(nil), h.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		idx := int(float64(len(sorted)-1) * h.policy.Percentile)
+		delay = sorted[idx]
+	}
+	if h.policy.MinDelay > 0 && delay < h.policy.MinDelay {
+		delay = h.policy.MinDelay
+	}
+	if h.policy.MaxDelay > 0 && delay > h.policy.MaxDelay {
+		delay = h.policy.MaxDelay
+	}
+	return delay
+}
+
+func (h *HedgedClient) observe(elapsed time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) < h.policy.WindowSize {
+		h.samples = append(h.samples, elapsed)
+		return
+	}
+	h.samples[h.next] = elapsed
+	h.next = (h.next + 1) % h.policy.WindowSize
+}
+
+func isSafeMethod(method HTTPMethod) bool {
+	switch method {
+	case GET, HEAD, OPTIONS:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,6 +1,7 @@
 package goutils
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"fmt"
@@ -8,6 +9,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 type HTTPMethod string
@@ -240,12 +243,22 @@ type API interface {
 }
 
 type APIClient struct {
+	client *http.Client
 }
 
 func NewAPIClient() *APIClient {
 	return &APIClient{}
 }
 
+// httpClient returns the client owned by c, falling back to http.DefaultClient
+// when none has been configured (e.g. via SetProxy).
+func (c *APIClient) httpClient() *http.Client {
+	if c.client != nil {
+		return c.client
+	}
+	return http.DefaultClient
+}
+
 func (c *APIClient) DoRequest(ctx context.Context, request *APIRequest) (*APIResult, *APIError) {
 	switch request.Method {
 	case GET:
@@ -268,11 +281,11 @@ func (c *APIClient) DoRequest(ctx context.Context, request *APIRequest) (*APIRes
 }
 
 func (c *APIClient) do(ctx context.Context, requestMethod string, request *APIRequest) (*APIResult, *APIError) {
-	req, reqErr := http.NewRequestWithContext(ctx, requestMethod, request.GetFullURL(), nil)
+	req, reqErr := newHTTPRequest(ctx, requestMethod, request)
 	if reqErr != nil {
 		return nil, &APIError{Message: fmt.Sprintf("build request: %v", reqErr)}
 	}
-	resp, doErr := http.DefaultClient.Do(req)
+	resp, doErr := c.httpClient().Do(req)
 	if doErr != nil {
 		return nil, &APIError{Message: fmt.Sprintf("do request: %v", doErr)}
 	}
@@ -285,6 +298,22 @@ func (c *APIClient) do(ctx context.Context, requestMethod string, request *APIRe
 	return result, nil
 }
 
+// newHTTPRequest converts request into an *http.Request carrying its headers and body.
+func newHTTPRequest(ctx context.Context, method string, request *APIRequest) (*http.Request, error) {
+	var body io.Reader
+	if len(request.Body) > 0 {
+		body = bytes.NewReader(request.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, request.GetFullURL(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range request.Headers {
+		req.Header.Set(key, value)
+	}
+	return req, nil
+}
+
 func (c *APIClient) DoRequestWithRetries(ctx context.Context, request *APIRequest, retries int) (*APIResult, *APIError) {
 	var lastErr *APIError
 	for i := 0; i <= retries; i++ {
@@ -318,7 +347,7 @@ func (c *APIClient) DoRequestWithRetriesAndTimeout(ctx context.Context, request
 }
 
 func (c *APIClient) DoRequestWithCustomClient(ctx context.Context, request *APIRequest, client *http.Client) (*APIResult, *APIError) {
-	req, reqErr := http.NewRequestWithContext(ctx, string(request.Method), request.GetFullURL(), nil)
+	req, reqErr := newHTTPRequest(ctx, string(request.Method), request)
 	if reqErr != nil {
 		return nil, &APIError{Message: fmt.Sprintf("build request: %v", reqErr)}
 	}
@@ -404,7 +433,7 @@ func (c *APIClient) IsURLReachable(ctx context.Context, url string) bool {
 	if err != nil {
 		return false
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
 		return false
 	}
@@ -419,7 +448,7 @@ func (c *APIClient) IsURLReachableWithTimeout(ctx context.Context, url string, t
 	if err != nil {
 		return false
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
 		return false
 	}
@@ -440,45 +469,153 @@ func (c *APIClient) IsURLReachableWithCustomClient(ctx context.Context, url stri
 	return resp.StatusCode >= 200 && resp.StatusCode < 400
 }
 
+// DebugOptions controls what the debugging transport logs. Requests and responses
+// are logged through Logger at debug level.
+type DebugOptions struct {
+	Logger            *Logger
+	RedactHeaders     []string
+	RedactJSONFields  []string
+	RedactQueryParams []string
+	// MaxBodyBytes truncates logged bodies. Zero logs bodies in full.
+	MaxBodyBytes  int
+	RedactionMask string
+}
+
+func DefaultDebugOptions() *DebugOptions {
+	return &DebugOptions{
+		Logger:            NewLogger(),
+		RedactHeaders:     DefaultRedactedHeaders,
+		RedactJSONFields:  DefaultRedactedJSONFields,
+		RedactQueryParams: DefaultRedactedQueryParams,
+		MaxBodyBytes:      4096,
+		RedactionMask:     DefaultRedactionMask,
+	}
+}
+
+// EnableHTTPDebugging logs requests with DefaultDebugOptions, keeping the current
+// options if debugging is already enabled.
 func (c *APIClient) EnableHTTPDebugging() {
-	http.DefaultTransport = &debugRoundTripper{rt: http.DefaultTransport}
+	rt := http.DefaultTransport
+	if c.client != nil {
+		rt = c.client.Transport
+	}
+	if _, ok := rt.(*debugRoundTripper); ok {
+		return
+	}
+	c.EnableHTTPDebuggingWithOptions(DefaultDebugOptions())
+}
+
+// EnableHTTPDebuggingWithOptions logs requests sent by c. Clients configured with
+// their own transport (e.g. via SetProxy) are debugged in isolation; otherwise
+// http.DefaultTransport is wrapped. Calling it again only updates the options.
+func (c *APIClient) EnableHTTPDebuggingWithOptions(opts *DebugOptions) {
+	if opts.Logger == nil {
+		opts.Logger = NewLogger()
+	}
+	if opts.RedactionMask == "" {
+		opts.RedactionMask = DefaultRedactionMask
+	}
+	if c.client != nil {
+		c.client.Transport = withDebugging(c.client.Transport, opts)
+		return
+	}
+	http.DefaultTransport = withDebugging(http.DefaultTransport, opts)
+}
+
+func withDebugging(rt http.RoundTripper, opts *DebugOptions) http.RoundTripper {
+	if d, ok := rt.(*debugRoundTripper); ok {
+		return &debugRoundTripper{rt: d.rt, opts: opts}
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &debugRoundTripper{rt: rt, opts: opts}
 }
 
 type debugRoundTripper struct {
-	rt http.RoundTripper
+	rt   http.RoundTripper
+	opts *DebugOptions
 }
 
 func (d *debugRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	fmt.Printf("Request: %s %s\n", req.Method, req.URL)
-	for key, value := range req.Header {
-		fmt.Printf("Header: %s: %s\n", key, strings.Join(value, ", "))
+	logger := d.opts.Logger
+	if !logger.IsLevelEnabled(logrus.DebugLevel) {
+		return d.rt.RoundTrip(req)
 	}
-	if req.Body != nil {
-		bodyBytes, err := io.ReadAll(req.Body)
-		if err == nil {
-			fmt.Printf("Body: %s\n", string(bodyBytes))
-			req.Body = io.NopCloser(strings.NewReader(string(bodyBytes)))
+
+	fields := logrus.Fields{
+		"method":  req.Method,
+		"url":     RedactURL(req.URL, d.opts.RedactQueryParams, d.opts.RedactionMask),
+		"headers": flattenHeader(RedactHeaders(req.Header, d.opts.RedactHeaders, d.opts.RedactionMask)),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		prefix, body, err := peekBody(req.Body, d.opts.MaxBodyBytes)
+		req.Body = body
+		if err != nil {
+			logger.WithError(err).Debug("http request body could not be read")
 		}
+		fields["body"] = formatBody(req.Header.Get("Content-Type"), prefix, bodySize(prefix, req.ContentLength, d.opts.MaxBodyBytes), d.opts)
 	}
+	logger.WithFields(fields).Debug("http request")
+
+	start := time.Now()
 	resp, err := d.rt.RoundTrip(req)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		logger.WithFields(logrus.Fields{"method": req.Method, "url": fields["url"]}).WithError(err).Debug("http request failed")
 		return nil, err
 	}
-	fmt.Printf("Response Status: %s\n", resp.Status)
-	for key, value := range resp.Header {
-		fmt.Printf("Response Header: %s: %s\n", key, strings.Join(value, ", "))
+
+	respFields := logrus.Fields{
+		"method":   req.Method,
+		"url":      fields["url"],
+		"status":   resp.StatusCode,
+		"duration": time.Since(start).String(),
+		"headers":  flattenHeader(RedactHeaders(resp.Header, d.opts.RedactHeaders, d.opts.RedactionMask)),
 	}
-	if resp.Body != nil {
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err == nil {
-			fmt.Printf("Response Body: %s\n", string(bodyBytes))
-			resp.Body = io.NopCloser(strings.NewReader(string(bodyBytes)))
+	if resp.Body != nil && resp.Body != http.NoBody {
+		prefix, body, err := peekBody(resp.Body, d.opts.MaxBodyBytes)
+		resp.Body = body
+		if err != nil {
+			logger.WithError(err).Debug("http response body could not be read")
 		}
+		respFields["body"] = formatBody(resp.Header.Get("Content-Type"), prefix, bodySize(prefix, resp.ContentLength, d.opts.MaxBodyBytes), d.opts)
 	}
+	logger.WithFields(respFields).Debug("http response")
 	return resp, nil
 }
 
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// peekBody reads up to limit+1 bytes of body (all of it when limit is zero) and
+// returns them along with a ReadCloser that replays the full body.
+func peekBody(body io.ReadCloser, limit int) ([]byte, io.ReadCloser, error) {
+	var r io.Reader = body
+	if limit > 0 {
+		r = io.LimitReader(body, int64(limit)+1)
+	}
+	prefix, err := io.ReadAll(r)
+	return prefix, readCloser{Reader: io.MultiReader(bytes.NewReader(prefix), body), Closer: body}, err
+}
+
+// bodySize returns the total size of a body of which prefix was read, or -1 when unknown.
+func bodySize(prefix []byte, contentLength int64, limit int) int64 {
+	if limit <= 0 || len(prefix) <= limit {
+		return int64(len(prefix))
+	}
+	return contentLength
+}
+
+func flattenHeader(header http.Header) map[string]string {
+	flat := make(map[string]string, len(header))
+	for key, values := range header {
+		flat[key] = strings.Join(values, ", ")
+	}
+	return flat
+}
+
 func (c *APIClient) DoRequestWithDebugging(ctx context.Context, request *APIRequest) (*APIResult, *APIError) {
 	c.EnableHTTPDebugging()
 	return c.DoRequest(ctx, request)
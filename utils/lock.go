@@ -0,0 +1,261 @@
+package goutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultMigrationLockKey identifies the migration lock when MigrationLockOptions.Key is empty.
+const DefaultMigrationLockKey = "goutils_migrations"
+
+// ErrMigrationLockTimeout is returned when the migration lock could not be
+// acquired within MigrationLockOptions.Timeout.
+var ErrMigrationLockTimeout = errors.New("timed out waiting for migration lock")
+
+// MigrationLockOptions controls how a MigrationLocker waits for the lock.
+type MigrationLockOptions struct {
+	// Key names the lock; replicas must use the same key. Defaults to DefaultMigrationLockKey.
+	Key string
+	// Timeout bounds the time spent waiting for the lock. Defaults to 5 minutes.
+	Timeout time.Duration
+	// PollInterval is the delay between two attempts. Defaults to 1 second.
+	PollInterval time.Duration
+}
+
+func (o MigrationLockOptions) withDefaults() MigrationLockOptions {
+	if o.Key == "" {
+		o.Key = DefaultMigrationLockKey
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Minute
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	return o
+}
+
+// MigrationLocker is a lock shared by all the replicas using the same database.
+type MigrationLocker interface {
+	// Lock blocks until the lock is acquired, the timeout expires or ctx is done.
+	Lock(ctx context.Context) error
+	Unlock(ctx context.Context) error
+}
+
+// tryLocker attempts to take a lock once without blocking.
+type tryLocker interface {
+	tryLock(ctx context.Context) (bool, error)
+	unlock(ctx context.Context) error
+	close() error
+}
+
+// NewMigrationLocker returns a MigrationLocker backed by a Postgres advisory
+// lock, a MySQL named lock or, for sqlite, a lock file next to the database.
+func (c *DBConn) NewMigrationLocker(opts MigrationLockOptions) (MigrationLocker, error) {
+	opts = opts.withDefaults()
+	dialect := c.migrationDialect()
+	if dialect == SQLITE3 {
+		return &migrationLocker{opts: opts, logger: c.logger, locker: newFileLocker(sqliteLockPath(c.dbConfig.Name, opts.Key))}, nil
+	}
+
+	dsn, err := c.dsn()
+	if err != nil {
+		return nil, err
+	}
+	var locker tryLocker
+	switch dialect {
+	case POSTGRESQL:
+		h := fnv.New64a()
+		h.Write([]byte(opts.Key))
+		locker = &sqlLocker{
+			driver:     c.dbConfig.Type,
+			dsn:        dsn,
+			tryQuery:   "SELECT pg_try_advisory_lock($1)",
+			unlockSQL:  "SELECT pg_advisory_unlock($1)",
+			lockHandle: int64(h.Sum64()),
+		}
+	case MYSQL:
+		// MySQL named locks are server-wide, so the key is scoped to the current
+		// database, and hashed to fit the 64-character limit on lock names.
+		locker = &sqlLocker{
+			driver:     c.dbConfig.Type,
+			dsn:        dsn,
+			tryQuery:   "SELECT GET_LOCK(" + mysqlLockName + ", 0)",
+			unlockSQL:  "SELECT RELEASE_LOCK(" + mysqlLockName + ")",
+			lockHandle: opts.Key,
+		}
+	default:
+		return nil, fmt.Errorf("migration locks are not supported for database type %q", dialect)
+	}
+	return &migrationLocker{opts: opts, logger: c.logger, locker: locker}, nil
+}
+
+const mysqlLockName = "SHA2(CONCAT(IFNULL(DATABASE(), ''), '.', ?), 256)"
+
+// WithMigrationLock runs fn while holding the migration lock.
+func (c *DBConn) WithMigrationLock(ctx context.Context, opts MigrationLockOptions, fn func() error) (err error) {
+	locker, err := c.NewMigrationLocker(opts)
+	if err != nil {
+		return err
+	}
+	if err := locker.Lock(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		// The lock must be released even if ctx was cancelled while fn ran.
+		if unlockErr := locker.Unlock(context.Background()); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+	return fn()
+}
+
+// MigrateWithLock applies pending migrations while holding the migration lock, so
+// that when several replicas start together one migrates and the others wait
+// for it to finish, then find nothing left to apply.
+func (c *DBConn) MigrateWithLock(ctx context.Context, opts MigrationLockOptions) error {
+	return c.WithMigrationLock(ctx, opts, func() error {
+		m, err := c.NewMigrator()
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+		return m.Up()
+	})
+}
+
+type migrationLocker struct {
+	opts   MigrationLockOptions
+	logger *logrus.Logger
+	locker tryLocker
+}
+
+func (l *migrationLocker) Lock(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, l.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	logger := l.logger.WithField("lock", l.opts.Key)
+	ticker := time.NewTicker(l.opts.PollInterval)
+	defer ticker.Stop()
+	waiting := false
+	for {
+		ok, err := l.locker.tryLock(ctx)
+		if err != nil && ctx.Err() == nil {
+			l.locker.close()
+			logger.WithError(err).Error("failed to acquire migration lock")
+			return fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		if ok {
+			logger.WithField("waited", time.Since(start)).Info("acquired migration lock")
+			return nil
+		}
+		if !waiting {
+			logger.Info("waiting for migration lock held by another instance")
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			l.locker.close()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				logger.WithField("timeout", l.opts.Timeout).Error("timed out waiting for migration lock")
+				return ErrMigrationLockTimeout
+			}
+			return fmt.Errorf("acquiring migration lock: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *migrationLocker) Unlock(ctx context.Context) error {
+	err := l.locker.unlock(ctx)
+	if closeErr := l.locker.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		l.logger.WithField("lock", l.opts.Key).WithError(err).Error("failed to release migration lock")
+		return fmt.Errorf("releasing migration lock: %w", err)
+	}
+	l.logger.WithField("lock", l.opts.Key).Info("released migration lock")
+	return nil
+}
+
+// sqlLocker holds a session-level database lock on a dedicated connection, since
+// the lock belongs to the session that took it.
+type sqlLocker struct {
+	driver     string
+	dsn        string
+	tryQuery   string
+	unlockSQL  string
+	lockHandle interface{}
+
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+func (l *sqlLocker) tryLock(ctx context.Context) (bool, error) {
+	if l.conn == nil {
+		db, err := sql.Open(l.driver, l.dsn)
+		if err != nil {
+			return false, err
+		}
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			db.Close()
+			return false, err
+		}
+		l.db, l.conn = db, conn
+	}
+	var acquired sql.NullBool
+	if err := l.conn.QueryRowContext(ctx, l.tryQuery, l.lockHandle).Scan(&acquired); err != nil {
+		return false, err
+	}
+	return acquired.Valid && acquired.Bool, nil
+}
+
+func (l *sqlLocker) unlock(ctx context.Context) error {
+	if l.conn == nil {
+		return errors.New("lock not held")
+	}
+	var released sql.NullBool
+	if err := l.conn.QueryRowContext(ctx, l.unlockSQL, l.lockHandle).Scan(&released); err != nil {
+		return err
+	}
+	if !released.Valid || !released.Bool {
+		return errors.New("lock not held")
+	}
+	return nil
+}
+
+func (l *sqlLocker) close() error {
+	if l.conn == nil {
+		return nil
+	}
+	l.conn.Close()
+	err := l.db.Close()
+	l.db, l.conn = nil, nil
+	return err
+}
+
+// sqliteLockPath places the lock file next to the database file, or in the
+// temporary directory for in-memory databases.
+func sqliteLockPath(name, key string) string {
+	path := strings.TrimPrefix(name, "file:")
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	if path == "" || path == ":memory:" || strings.Contains(name, "mode=memory") {
+		return filepath.Join(os.TempDir(), key+".lock")
+	}
+	return path + "." + key + ".lock"
+}
@@ -0,0 +1,44 @@
+//go:build !unix
+
+package goutils
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// fileLocker treats the existence of a lock file as the lock. Unlike flock the
+// file is left behind if the process dies and must then be removed by hand.
+type fileLocker struct {
+	path string
+	held bool
+}
+
+func newFileLocker(path string) tryLocker {
+	return &fileLocker{path: path}
+}
+
+func (l *fileLocker) tryLock(ctx context.Context) (bool, error) {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	l.held = true
+	return true, file.Close()
+}
+
+func (l *fileLocker) unlock(ctx context.Context) error {
+	if !l.held {
+		return errors.New("lock not held")
+	}
+	l.held = false
+	return os.Remove(l.path)
+}
+
+func (l *fileLocker) close() error {
+	return nil
+}
@@ -0,0 +1,52 @@
+//go:build unix
+
+package goutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+)
+
+// fileLocker holds an flock on a lock file, which the kernel releases if the
+// process dies.
+type fileLocker struct {
+	path string
+	file *os.File
+}
+
+func newFileLocker(path string) tryLocker {
+	return &fileLocker{path: path}
+}
+
+func (l *fileLocker) tryLock(ctx context.Context) (bool, error) {
+	if l.file == nil {
+		file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o644)
+		if err != nil {
+			return false, err
+		}
+		l.file = file
+	}
+	err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *fileLocker) unlock(ctx context.Context) error {
+	if l.file == nil {
+		return errors.New("lock not held")
+	}
+	return syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+}
+
+func (l *fileLocker) close() error {
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,193 @@
+package goutils
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dlmiddlecote/sqlstats"
+	"github.com/jinzhu/gorm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultSlowQueryThreshold is used when DatabaseConfig.SlowQueryThreshold is zero.
+const DefaultSlowQueryThreshold = time.Second
+
+// queryObserver is called after every gorm operation with its duration.
+type queryObserver func(scope *gorm.Scope, operation string, elapsed time.Duration)
+
+// observeQueries registers gorm callbacks timing create, query, update, delete
+// and row query operations. name must be unique per observer; registering the
+// same name again replaces the previous observer.
+func observeQueries(db *gorm.DB, name string, observe queryObserver) {
+	startName, endName := "goutils:"+name+":start", "goutils:"+name+":end"
+	start := func(scope *gorm.Scope) {
+		scope.Set(startName, time.Now())
+	}
+	end := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			if started, ok := scope.Get(startName); ok {
+				observe(scope, operation, time.Since(started.(time.Time)))
+			}
+		}
+	}
+
+	callbacks := db.Callback()
+	register := func(processor func() *gorm.CallbackProcessor, first, last, operation string) {
+		if processor().Get(endName) != nil {
+			processor().Before(first).Replace(startName, start)
+			processor().After(last).Replace(endName, end(operation))
+			return
+		}
+		processor().Before(first).Register(startName, start)
+		processor().After(last).Register(endName, end(operation))
+	}
+	register(callbacks.Create, "gorm:begin_transaction", "gorm:commit_or_rollback_transaction", "create")
+	register(callbacks.Update, "gorm:begin_transaction", "gorm:commit_or_rollback_transaction", "update")
+	register(callbacks.Delete, "gorm:begin_transaction", "gorm:commit_or_rollback_transaction", "delete")
+	register(callbacks.Query, "gorm:query", "gorm:after_query", "query")
+	register(callbacks.RowQuery, "gorm:row_query", "gorm:row_query", "row_query")
+}
+
+// queryTable returns the table of the scope, or "raw" for raw SQL.
+func queryTable(scope *gorm.Scope) string {
+	if table := scope.TableName(); table != "" {
+		return table
+	}
+	return "raw"
+}
+
+// queryError returns the error of the operation, ignoring record not found.
+func queryError(scope *gorm.Scope) error {
+	err := scope.DB().Error
+	if err == nil || gorm.IsRecordNotFoundError(err) {
+		return nil
+	}
+	return err
+}
+
+type queryMetrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	slow     *prometheus.CounterVec
+}
+
+var queryMetricLabels = []string{"operation", "table"}
+
+func newQueryMetrics(namespace string) *queryMetrics {
+	return &queryMetrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "query_duration_seconds",
+			Help:      "Duration of database queries.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, queryMetricLabels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "query_errors_total",
+			Help:      "Number of failed database queries.",
+		}, queryMetricLabels),
+		slow: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "slow_queries_total",
+			Help:      "Number of database queries slower than the slow query threshold.",
+		}, queryMetricLabels),
+	}
+}
+
+// register registers the metrics, reusing collectors already registered by
+// another pool with the same name, namespace and labels.
+func (m *queryMetrics) register(registerer prometheus.Registerer) error {
+	var errs []error
+	m.duration, errs = registerOrExisting(registerer, m.duration, errs)
+	m.errors, errs = registerOrExisting(registerer, m.errors, errs)
+	m.slow, errs = registerOrExisting(registerer, m.slow, errs)
+	return errors.Join(errs...)
+}
+
+func registerOrExisting[C prometheus.Collector](registerer prometheus.Registerer, c C, errs []error) (C, []error) {
+	if err := registerer.Register(c); err != nil {
+		var already prometheus.AlreadyRegisteredError
+		if errors.As(err, &already) {
+			if existing, ok := already.ExistingCollector.(C); ok {
+				return existing, errs
+			}
+		}
+		return c, append(errs, err)
+	}
+	return c, errs
+}
+
+// registerDBMetrics exports connection pool statistics and, through gorm
+// callbacks, per-operation and per-table query latency, errors and slow queries.
+// previous is the stats collector registered for an earlier pool of the same
+// DBConn, which the new pool replaces; the stats of another DBConn using the same
+// labels are left in place. It returns the stats collector now registered for
+// the DBConn.
+func registerDBMetrics(logger *logrus.Logger, db *gorm.DB, dbConfig *DatabaseConfig, previous prometheus.Collector) prometheus.Collector {
+	registerer := dbConfig.MetricsRegisterer
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	labels := prometheus.Labels{"db_name": metricsName(dbConfig)}
+	for key, value := range dbConfig.MetricsLabels {
+		labels[key] = value
+	}
+
+	// sqlstats adds db_name itself.
+	statsLabels := prometheus.Labels{}
+	for key, value := range dbConfig.MetricsLabels {
+		statsLabels[key] = value
+	}
+	statsRegisterer := prometheus.WrapRegistererWith(statsLabels, registerer)
+	var collector prometheus.Collector = sqlstats.NewStatsCollector(metricsName(dbConfig), db.DB())
+	err := statsRegisterer.Register(collector)
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) && previous != nil && already.ExistingCollector == previous {
+		// A reconnected pool replaces the stats of the one it supersedes.
+		statsRegisterer.Unregister(previous)
+		err = statsRegisterer.Register(collector)
+	}
+	if err != nil {
+		logger.WithError(err).WithField("db_name", metricsName(dbConfig)).
+			Warn("failed to register sqlstats collector, is MetricsName shared with another pool?")
+		collector = nil
+	}
+
+	metrics := newQueryMetrics(dbConfig.MetricsNamespace)
+	if err := metrics.register(prometheus.WrapRegistererWith(labels, registerer)); err != nil {
+		logger.WithError(err).Warn("failed to register query metrics")
+		return collector
+	}
+
+	threshold := dbConfig.SlowQueryThreshold
+	if threshold <= 0 {
+		threshold = DefaultSlowQueryThreshold
+	}
+	observeQueries(db, "metrics", func(scope *gorm.Scope, operation string, elapsed time.Duration) {
+		table := queryTable(scope)
+		metrics.duration.WithLabelValues(operation, table).Observe(elapsed.Seconds())
+		if queryError(scope) != nil {
+			metrics.errors.WithLabelValues(operation, table).Inc()
+		}
+		if elapsed >= threshold {
+			metrics.slow.WithLabelValues(operation, table).Inc()
+		}
+	})
+	return collector
+}
+
+// metricsName returns DatabaseConfig.MetricsName, defaulting to the database name.
+func metricsName(dbConfig *DatabaseConfig) string {
+	if dbConfig.MetricsName != "" {
+		return dbConfig.MetricsName
+	}
+	if name := strings.TrimSpace(dbConfig.Name); name != "" {
+		return name
+	}
+	return dbConfig.Type
+}
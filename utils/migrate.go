@@ -0,0 +1,381 @@
+package goutils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	migratemysql "github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultMigrationsPath is used when DatabaseConfig.MigrationsPath is empty.
+const DefaultMigrationsPath = "migrations"
+
+// MigrationVersionFormat is the timestamp layout used as version by CreateMigrationFiles.
+const MigrationVersionFormat = "20060102150405"
+
+// ErrNoMigration is returned by Migrator.Version when no migration has been applied.
+var ErrNoMigration = migrate.ErrNilVersion
+
+// DirtyMigrationError is returned when a previous migration failed part-way and
+// left the schema in an unknown state.
+type DirtyMigrationError struct {
+	Version uint
+	// Previous is the version before Version, or -1 if Version is the first migration.
+	Previous int
+}
+
+func (e *DirtyMigrationError) Error() string {
+	return fmt.Sprintf("database is dirty at migration version %d: repair the schema by hand, then "+
+		"run Force(%d) if the migration was fully applied or Force(%d) if it was not, and migrate again",
+		e.Version, e.Version, e.Previous)
+}
+
+type MigrationInfo struct {
+	Version uint
+	Name    string
+	Applied bool
+}
+
+// MigrationStatus describes the applied and pending migrations of a database.
+type MigrationStatus struct {
+	// Version is the current version, zero when no migration has been applied.
+	Version uint
+	Dirty   bool
+	Applied []MigrationInfo
+	Pending []MigrationInfo
+}
+
+// Migrator runs versioned SQL migrations against the database of a DBConn.
+// It must be closed after use.
+type Migrator struct {
+	m          *migrate.Migrate
+	openSource func() (source.Driver, error)
+	logger     *logrus.Logger
+}
+
+// NewMigrator returns a Migrator reading migrations from DatabaseConfig.MigrationsPath,
+// inside DatabaseConfig.MigrationsFS when it is set.
+func (c *DBConn) NewMigrator() (*Migrator, error) {
+	if c.dbConfig.MigrationsFS != nil {
+		return c.NewMigratorFromFS(c.dbConfig.MigrationsFS, c.migrationsPath())
+	}
+	return c.NewMigratorFromPath(c.migrationsPath())
+}
+
+// NewMigratorFromPath returns a Migrator reading migrations from a directory.
+func (c *DBConn) NewMigratorFromPath(migrationsPath string) (*Migrator, error) {
+	sourceURL := fmt.Sprintf("file://%s", migrationsPath)
+	return c.newMigrator("file", func() (source.Driver, error) {
+		return (&file.File{}).Open(sourceURL)
+	})
+}
+
+// NewMigratorFromFS returns a Migrator reading migrations from dir inside fsys,
+// typically an embed.FS compiled into the binary.
+func (c *DBConn) NewMigratorFromFS(fsys fs.FS, dir string) (*Migrator, error) {
+	if fsys == nil {
+		return nil, errors.New("opening migrations source: nil fs.FS")
+	}
+	return c.newMigrator("iofs", func() (source.Driver, error) {
+		return iofs.New(fsys, dir)
+	})
+}
+
+func (c *DBConn) newMigrator(sourceName string, openSource func() (source.Driver, error)) (*Migrator, error) {
+	src, err := openSource()
+	if err != nil {
+		c.logger.Errorf("opening migrations source: %v", err)
+		return nil, fmt.Errorf("opening migrations source: %w", err)
+	}
+	driver, err := c.migrationDriver()
+	if err != nil {
+		src.Close()
+		c.logger.Errorf("Run : initializing migrator: %v", err)
+		return nil, fmt.Errorf("initializing migrator: %w", err)
+	}
+	m, err := migrate.NewWithInstance(sourceName, src, c.migrationDialect(), driver)
+	if err != nil {
+		src.Close()
+		driver.Close()
+		c.logger.Errorf("Run : initializing migrator: %v", err)
+		return nil, fmt.Errorf("initializing migrator: %w", err)
+	}
+	m.Log = migrateLogger{c.logger}
+	return &Migrator{m: m, openSource: openSource, logger: c.logger}, nil
+}
+
+func (c *DBConn) migrationsPath() string {
+	if c.dbConfig.MigrationsPath != "" {
+		return c.dbConfig.MigrationsPath
+	}
+	return DefaultMigrationsPath
+}
+
+// migrationDialect returns the dialect migrations are written for, resolving
+// hotload DSNs to their underlying driver.
+func (c *DBConn) migrationDialect() string {
+	if c.IsHotload() {
+		dsn, _ := c.dsn()
+		if u, err := url.Parse(dsn); err == nil {
+			return u.Hostname()
+		}
+	}
+	return c.dbConfig.Type
+}
+
+var (
+	migrationDriversMu sync.RWMutex
+	migrationDrivers   = map[string]func(*sql.DB) (database.Driver, error){
+		POSTGRESQL: func(db *sql.DB) (database.Driver, error) {
+			return postgres.WithInstance(db, &postgres.Config{})
+		},
+		MYSQL: func(db *sql.DB) (database.Driver, error) {
+			return migratemysql.WithInstance(db, &migratemysql.Config{})
+		},
+	}
+)
+
+// RegisterMigrationDriver makes migrations available for a database type, given
+// the function wrapping a connection into a golang-migrate driver. PostgreSQL and
+// MySQL are built in; SQLite is registered by the sqlite subpackage.
+func RegisterMigrationDriver(dbType string, open func(*sql.DB) (database.Driver, error)) {
+	migrationDriversMu.Lock()
+	defer migrationDriversMu.Unlock()
+	migrationDrivers[dbType] = open
+}
+
+// migrationDriver opens a dedicated connection for golang-migrate, which closes
+// it along with the Migrator so that the application's pool is never affected.
+func (c *DBConn) migrationDriver() (database.Driver, error) {
+	dsn, err := c.dsn()
+	if err != nil {
+		return nil, err
+	}
+	dialect := c.migrationDialect()
+	if dialect == MYSQL && !c.IsHotload() {
+		// Migration files commonly hold several statements.
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MultiStatements = true
+		dsn = cfg.FormatDSN()
+	}
+
+	migrationDriversMu.RLock()
+	open, ok := migrationDrivers[dialect]
+	migrationDriversMu.RUnlock()
+	if !ok {
+		if dialect == SQLITE3 {
+			return nil, fmt.Errorf("migrations for %s require importing %s", SQLITE3, sqlitePackage)
+		}
+		return nil, fmt.Errorf("migrations are not supported for database type %q", dialect)
+	}
+
+	db, err := sql.Open(c.dbConfig.Type, dsn)
+	if err != nil {
+		return nil, err
+	}
+	driver, err := open(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return driver, nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up() error {
+	if err := m.wrap(m.m.Up()); err != nil {
+		m.logger.Errorf("running migrations: %v", err)
+		return fmt.Errorf("running migrations: %w", err)
+	}
+	return nil
+}
+
+// Down rolls back the last n applied migrations. n must be at least 1; use
+// DownAll to roll back every migration.
+func (m *Migrator) Down(n int) error {
+	if n < 1 {
+		return fmt.Errorf("running rollback migrations: invalid number of steps %d", n)
+	}
+	return m.down(m.m.Steps(-n))
+}
+
+// DownAll rolls back every applied migration.
+func (m *Migrator) DownAll() error {
+	return m.down(m.m.Down())
+}
+
+func (m *Migrator) down(err error) error {
+	var short migrate.ErrShortLimit
+	if errors.As(err, &short) {
+		m.logger.Warnf("rolled back %d fewer migrations than requested", short.Short)
+		err = nil
+	}
+	if err := m.wrap(err); err != nil {
+		m.logger.Errorf("running rollback migrations: %v", err)
+		return fmt.Errorf("running rollback migrations: %w", err)
+	}
+	return nil
+}
+
+// Goto migrates up or down to the given version.
+func (m *Migrator) Goto(version uint) error {
+	if err := m.wrap(m.m.Migrate(version)); err != nil {
+		m.logger.Errorf("migrating to version %d: %v", version, err)
+		return fmt.Errorf("migrating to version %d: %w", version, err)
+	}
+	return nil
+}
+
+// Force sets the version without running migrations and clears the dirty flag.
+// A version of -1 means that no migration is applied.
+func (m *Migrator) Force(version int) error {
+	if err := m.m.Force(version); err != nil {
+		m.logger.Errorf("forcing version %d: %v", version, err)
+		return fmt.Errorf("forcing version %d: %w", version, err)
+	}
+	m.logger.Warnf("forced migration version to %d", version)
+	return nil
+}
+
+// Version returns the current version and dirty flag, or ErrNoMigration.
+func (m *Migrator) Version() (uint, bool, error) {
+	return m.m.Version()
+}
+
+// Status lists the migrations found in the source as applied or pending.
+func (m *Migrator) Status() (*MigrationStatus, error) {
+	status := &MigrationStatus{}
+	version, dirty, err := m.m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return nil, fmt.Errorf("getting migration version: %w", err)
+	}
+	status.Version, status.Dirty = version, dirty
+	applied := err == nil
+
+	src, err := m.openSource()
+	if err != nil {
+		return nil, fmt.Errorf("opening migrations source: %w", err)
+	}
+	defer src.Close()
+
+	v, err := src.First()
+	for err == nil {
+		info := MigrationInfo{Version: v, Name: migrationName(src, v), Applied: applied && v <= version}
+		if info.Applied {
+			status.Applied = append(status.Applied, info)
+		} else {
+			status.Pending = append(status.Pending, info)
+		}
+		v, err = src.Next(v)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading migrations source: %w", err)
+	}
+	return status, nil
+}
+
+// Close releases the migrations source and the migration connection.
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.m.Close()
+	if srcErr != nil {
+		m.logger.Errorf("closing migrator: %v", srcErr)
+		return srcErr
+	}
+	if dbErr != nil {
+		m.logger.Errorf("closing migrator: %v", dbErr)
+		return dbErr
+	}
+	return nil
+}
+
+// wrap ignores ErrNoChange and turns ErrDirty into a DirtyMigrationError.
+func (m *Migrator) wrap(err error) error {
+	if err == nil || errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	var dirty migrate.ErrDirty
+	if !errors.As(err, &dirty) {
+		return err
+	}
+	dirtyErr := &DirtyMigrationError{Version: uint(dirty.Version), Previous: -1}
+	if src, srcErr := m.openSource(); srcErr == nil {
+		if prev, prevErr := src.Prev(uint(dirty.Version)); prevErr == nil {
+			dirtyErr.Previous = int(prev)
+		}
+		src.Close()
+	}
+	return dirtyErr
+}
+
+var migrationNameReplacer = regexp.MustCompile(`[^a-z0-9]+`)
+
+// CreateMigrationFiles creates empty up and down SQL files in dir, named after
+// now and name, e.g. 20240102150405_add_users.up.sql, and returns their paths.
+func CreateMigrationFiles(dir, name string, now time.Time) (string, string, error) {
+	name = strings.Trim(migrationNameReplacer.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", errors.New("migration name must contain letters or digits")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", fmt.Errorf("creating migrations directory: %w", err)
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%s_%s", now.UTC().Format(MigrationVersionFormat), name))
+	up, down := base+".up.sql", base+".down.sql"
+	for i, path := range []string{up, down} {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			if i > 0 {
+				os.Remove(up)
+			}
+			return "", "", fmt.Errorf("creating migration file: %w", err)
+		}
+		f.Close()
+	}
+	return up, down, nil
+}
+
+func migrationName(src source.Driver, version uint) string {
+	r, identifier, err := src.ReadUp(version)
+	if err != nil {
+		r, identifier, err = src.ReadDown(version)
+	}
+	if err != nil {
+		return ""
+	}
+	r.Close()
+	return identifier
+}
+
+// migrateLogger adapts a logrus logger to migrate.Logger.
+type migrateLogger struct {
+	logger *logrus.Logger
+}
+
+func (l migrateLogger) Printf(format string, v ...interface{}) {
+	l.logger.Infof(strings.TrimSuffix(format, "\n"), v...)
+}
+
+func (l migrateLogger) Verbose() bool {
+	return l.logger.IsLevelEnabled(logrus.DebugLevel)
+}
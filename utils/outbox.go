@@ -0,0 +1,254 @@
+package goutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DefaultOutboxTable is the table used when OutboxOptions.Table is not set.
+const DefaultOutboxTable = "outbox_messages"
+
+// OutboxMessage is a row of the outbox table.
+type OutboxMessage struct {
+	ID    uint64 `gorm:"primary_key"`
+	Topic string `gorm:"not null"`
+	// Key orders the messages of a topic: they are published in order, and one
+	// failing holds back the next ones.
+	Key     string `gorm:"column:message_key;index"`
+	Payload []byte
+	// Attempts counts the failed and successful publications.
+	Attempts  int    `gorm:"not null;default:0"`
+	LastError string `gorm:"type:text"`
+	// AvailableAt delays the next publication after a failure.
+	AvailableAt time.Time `gorm:"not null;index"`
+	CreatedAt   time.Time
+	DeliveredAt *time.Time `gorm:"index"`
+}
+
+// Publisher publishes outbox messages to a broker. Since a message is published
+// again if marking it delivered fails, consumers must be idempotent.
+type Publisher interface {
+	Publish(ctx context.Context, msg *OutboxMessage) error
+}
+
+// PublisherFunc adapts a function to Publisher.
+type PublisherFunc func(ctx context.Context, msg *OutboxMessage) error
+
+func (f PublisherFunc) Publish(ctx context.Context, msg *OutboxMessage) error {
+	return f(ctx, msg)
+}
+
+// OutboxOptions configures an Outbox. A nil *OutboxOptions uses the defaults.
+type OutboxOptions struct {
+	// Table defaults to DefaultOutboxTable.
+	Table  string
+	Logger *Logger
+	// BatchSize is the number of messages relayed per transaction. Defaults to 100.
+	BatchSize int
+	// PollInterval is the wait between polls once the outbox is drained. Defaults
+	// to 1 second.
+	PollInterval time.Duration
+	// InitialBackoff and MaxBackoff bound the jittered exponential delay before a
+	// failed message is published again. They default to 1s and 5m.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxAttempts stops publishing a message after that many failures, leaving it
+	// undelivered with its LastError. Zero retries forever.
+	MaxAttempts int
+}
+
+func (o *OutboxOptions) withDefaults() OutboxOptions {
+	var opts OutboxOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.Table == "" {
+		opts.Table = DefaultOutboxTable
+	}
+	if opts.Logger == nil {
+		opts.Logger = NewLogger()
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	return opts
+}
+
+// Outbox implements the transactional outbox pattern: messages are written to a
+// table in the transaction of the change they describe, so that they are saved
+// if and only if it commits, and a relay publishes them afterwards.
+type Outbox struct {
+	db   func() *gorm.DB
+	opts OutboxOptions
+}
+
+func NewOutbox(db *gorm.DB, opts *OutboxOptions) *Outbox {
+	return &Outbox{db: func() *gorm.DB { return db }, opts: opts.withDefaults()}
+}
+
+// NewOutbox returns an Outbox relaying through the pool of c, following its
+// credential rotations. Connect must have been called.
+func (c *DBConn) NewOutbox(opts *OutboxOptions) *Outbox {
+	return &Outbox{db: c.DB, opts: opts.withDefaults()}
+}
+
+func (o *Outbox) table(db *gorm.DB) *gorm.DB {
+	return db.Table(o.opts.Table)
+}
+
+// Migrate creates or updates the outbox table.
+func (o *Outbox) Migrate() error {
+	return o.table(o.db()).AutoMigrate(&OutboxMessage{}).Error
+}
+
+// Enqueue adds a message to the outbox through tx, which should be the
+// transaction making the change the message describes.
+func (o *Outbox) Enqueue(ctx context.Context, tx *gorm.DB, topic, key string, payload []byte) (*OutboxMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if topic == "" {
+		return nil, errors.New("enqueueing outbox message: empty topic")
+	}
+	msg := &OutboxMessage{Topic: topic, Key: key, Payload: payload, AvailableAt: gorm.NowFunc()}
+	if err := o.table(tx).Create(msg).Error; err != nil {
+		return nil, fmt.Errorf("enqueueing outbox message: %w", err)
+	}
+	return msg, nil
+}
+
+// EnqueueJSON is like Enqueue with v encoded as JSON.
+func (o *Outbox) EnqueueJSON(ctx context.Context, tx *gorm.DB, topic, key string, v interface{}) (*OutboxMessage, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("enqueueing outbox message: %w", err)
+	}
+	return o.Enqueue(ctx, tx, topic, key, payload)
+}
+
+// Relay publishes the pending messages until ctx is done, polling every
+// PollInterval once a batch publishes nothing. Several relays can run
+// concurrently on Postgres and MySQL 8, whose rows are locked with FOR UPDATE
+// SKIP LOCKED.
+func (o *Outbox) Relay(ctx context.Context, publisher Publisher) error {
+	for {
+		n, err := o.RelayOnce(ctx, publisher)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			o.opts.Logger.WithError(err).Error("failed to relay outbox messages")
+		}
+		if n > 0 && err == nil {
+			continue
+		}
+		if err := sleepContext(ctx, o.opts.PollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// RelayOnce publishes one batch of the pending messages in order, in a
+// transaction holding their rows locked, and returns the number of messages
+// published. A message with a non-empty key is only selected once the earlier
+// messages with the same topic and key are delivered or given up, so a batch
+// publishes at most one message per key, and the messages following one that
+// waits for a retry or is locked by another relay are left alone.
+func (o *Outbox) RelayOnce(ctx context.Context, publisher Publisher) (int, error) {
+	db := o.db()
+	if db == nil {
+		return 0, errors.New("relaying outbox: not connected")
+	}
+
+	var published int
+	// Not retried, which would publish the batch again.
+	err := WithTransaction(ctx, db, &TxOptions{MaxRetries: -1}, func(tx *gorm.DB) error {
+		published = 0
+		query := o.table(tx).Where("delivered_at IS NULL AND available_at <= ?", gorm.NowFunc())
+		if o.opts.MaxAttempts > 0 {
+			query = query.Where("attempts < ?", o.opts.MaxAttempts)
+		}
+		table := tx.Dialect().Quote(o.opts.Table)
+		earlier := "SELECT 1 FROM %[1]s earlier WHERE earlier.topic = %[1]s.topic AND earlier.message_key = %[1]s.message_key" +
+			" AND earlier.id < %[1]s.id AND earlier.delivered_at IS NULL"
+		var args []interface{}
+		if o.opts.MaxAttempts > 0 {
+			earlier += " AND earlier.attempts < ?"
+			args = append(args, o.opts.MaxAttempts)
+		}
+		query = query.Where(fmt.Sprintf("message_key = '' OR NOT EXISTS ("+earlier+")", table), args...)
+		if name := tx.Dialect().GetName(); name == POSTGRESQL || name == MYSQL {
+			query = query.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED")
+		}
+		var msgs []*OutboxMessage
+		if err := query.Order("id").Limit(o.opts.BatchSize).Find(&msgs).Error; err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := o.publish(ctx, tx, publisher, msg); err != nil {
+				return err
+			}
+			if msg.DeliveredAt != nil {
+				published++
+			}
+		}
+		return nil
+	})
+	return published, err
+}
+
+// publish publishes msg and records the outcome. Only failing to record it is
+// returned, the publication error is saved in the message.
+func (o *Outbox) publish(ctx context.Context, tx *gorm.DB, publisher Publisher, msg *OutboxMessage) error {
+	msg.Attempts++
+	updates := map[string]interface{}{"attempts": msg.Attempts}
+	logger := o.opts.Logger.WithField("outbox_id", msg.ID).WithField("topic", msg.Topic).WithField("attempts", msg.Attempts)
+
+	if err := publisher.Publish(ctx, msg); err != nil {
+		msg.LastError = err.Error()
+		msg.AvailableAt = gorm.NowFunc().Add(backoff{initial: o.opts.InitialBackoff, max: o.opts.MaxBackoff}.delay(msg.Attempts - 1))
+		updates["last_error"], updates["available_at"] = msg.LastError, msg.AvailableAt
+		if o.opts.MaxAttempts > 0 && msg.Attempts >= o.opts.MaxAttempts {
+			logger.WithError(err).Error("giving up publishing outbox message")
+		} else {
+			logger.WithError(err).WithField("retry_at", msg.AvailableAt).Warn("failed to publish outbox message")
+		}
+	} else {
+		now := gorm.NowFunc()
+		msg.DeliveredAt = &now
+		updates["delivered_at"] = now
+	}
+
+	if err := o.table(tx).Where("id = ?", msg.ID).UpdateColumns(updates).Error; err != nil {
+		return fmt.Errorf("recording outbox message %d: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// PurgeDelivered deletes the messages delivered before olderThan ago and returns
+// how many were deleted.
+func (o *Outbox) PurgeDelivered(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	result := o.table(o.db()).Where("delivered_at IS NOT NULL AND delivered_at < ?", gorm.NowFunc().Add(-olderThan)).Delete(&OutboxMessage{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,270 @@
+package goutils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DefaultPageLimit is the page size used when PageRequest.Limit is not set.
+const DefaultPageLimit = 20
+
+// ErrInvalidCursor is returned for cursors that are malformed or were issued
+// for another sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageRequest selects a page of a keyset pagination. After and Before are
+// cursors from a previous Page, at most one of them may be set.
+type PageRequest struct {
+	After  string
+	Before string
+	Limit  int
+	// OrderBy lists the sort fields, descending when prefixed by "-". The primary
+	// key is appended as a tie-breaker. Sort columns must not be NULL.
+	OrderBy []string
+}
+
+// ParsePageRequest reads the "after", "before" and "limit" query parameters.
+func ParsePageRequest(values url.Values) (PageRequest, error) {
+	req := PageRequest{After: values.Get("after"), Before: values.Get("before")}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return req, fmt.Errorf("invalid limit %q", raw)
+		}
+		req.Limit = limit
+	}
+	if req.After != "" && req.Before != "" {
+		return req, errors.New("after and before cannot be used together")
+	}
+	return req, nil
+}
+
+// Page is a page of items with the cursors of the adjacent pages, empty when
+// there is none.
+type Page[T any] struct {
+	Items []T    `json:"items"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+}
+
+type sortKey struct {
+	column string
+	desc   bool
+}
+
+func (k sortKey) String() string {
+	if k.desc {
+		return "-" + k.column
+	}
+	return k.column
+}
+
+// cursor is the JSON encoded inside the opaque cursors. Keys identifies the sort
+// order the values belong to.
+type cursor struct {
+	Keys   []string          `json:"k"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// Paginate returns a page of the entities matched by query, which may hold
+// conditions but no ordering, limit or offset. Rather than an offset, it seeks
+// past the sort values of the cursor, so pages cost the same wherever they are
+// as long as the sort columns are indexed.
+func Paginate[T any](ctx context.Context, query *gorm.DB, req PageRequest) (*Page[T], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req.After != "" && req.Before != "" {
+		return nil, errors.New("paginating: after and before cannot be used together")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+
+	var model T
+	keys, err := pageSortKeys(query, &model, req.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	backward := req.Before != ""
+	if token := req.After + req.Before; token != "" {
+		values, err := decodeCursor(query, &model, keys, token)
+		if err != nil {
+			return nil, err
+		}
+		condition, args := keysetCondition(query.Dialect(), keys, values, backward)
+		query = query.Where(condition, args...)
+	}
+	for _, key := range keys {
+		direction := "ASC"
+		if key.desc != backward {
+			direction = "DESC"
+		}
+		query = query.Order(fmt.Sprintf("%s %s", query.Dialect().Quote(key.column), direction))
+	}
+
+	items := []T{}
+	if err := query.Limit(limit + 1).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	more := len(items) > limit
+	if more {
+		items = items[:limit]
+	}
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	page := &Page[T]{Items: items}
+	if len(items) == 0 {
+		return page, nil
+	}
+	if more || backward {
+		if page.Next, err = encodeCursor(query, keys, &items[len(items)-1]); err != nil {
+			return nil, err
+		}
+	}
+	if (more && backward) || req.After != "" {
+		if page.Prev, err = encodeCursor(query, keys, &items[0]); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// Paginate returns a page of the entities matching filters. See Paginate.
+func (r *Repository[T]) Paginate(ctx context.Context, req PageRequest, filters ...QueryFilter) (*Page[T], error) {
+	db, err := r.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if db, err = r.applyFilters(db, filters); err != nil {
+		return nil, err
+	}
+	return Paginate[T](ctx, db, req)
+}
+
+// pageSortKeys resolves orderBy to columns of model and appends the primary key,
+// in the direction of the last key, so that the order is total.
+func pageSortKeys(db *gorm.DB, model interface{}, orderBy []string) ([]sortKey, error) {
+	columns := modelColumns(db, model)
+	primaryKey := db.NewScope(model).PrimaryKey()
+	keys := make([]sortKey, 0, len(orderBy)+1)
+	hasPrimaryKey := false
+	for _, order := range orderBy {
+		key := sortKey{column: order}
+		if strings.HasPrefix(order, "-") {
+			key = sortKey{column: order[1:], desc: true}
+		}
+		column, ok := columns[key.column]
+		if !ok {
+			return nil, fmt.Errorf("paginating: unknown sort field %q", key.column)
+		}
+		key.column = column
+		hasPrimaryKey = hasPrimaryKey || column == primaryKey
+		keys = append(keys, key)
+	}
+	if !hasPrimaryKey {
+		if primaryKey == "" {
+			return nil, errors.New("paginating: model has no primary key")
+		}
+		desc := len(keys) > 0 && keys[len(keys)-1].desc
+		keys = append(keys, sortKey{column: primaryKey, desc: desc})
+	}
+	return keys, nil
+}
+
+// keysetCondition returns the condition selecting the rows after values in the
+// order of keys, or before them when backward:
+// (a > ?) OR (a = ? AND b > ?) OR (a = ? AND b = ? AND c > ?).
+func keysetCondition(dialect gorm.Dialect, keys []sortKey, values []interface{}, backward bool) (string, []interface{}) {
+	var disjuncts []string
+	var args []interface{}
+	for i, key := range keys {
+		conjuncts := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			conjuncts = append(conjuncts, dialect.Quote(keys[j].column)+" = ?")
+			args = append(args, values[j])
+		}
+		op := ">"
+		if key.desc != backward {
+			op = "<"
+		}
+		conjuncts = append(conjuncts, fmt.Sprintf("%s %s ?", dialect.Quote(key.column), op))
+		args = append(args, values[i])
+		disjuncts = append(disjuncts, "("+strings.Join(conjuncts, " AND ")+")")
+	}
+	return strings.Join(disjuncts, " OR "), args
+}
+
+func cursorKeys(keys []sortKey) []string {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.String()
+	}
+	return names
+}
+
+func encodeCursor(db *gorm.DB, keys []sortKey, item interface{}) (string, error) {
+	scope := db.NewScope(item)
+	c := cursor{Keys: cursorKeys(keys), Values: make([]json.RawMessage, len(keys))}
+	for i, key := range keys {
+		field, ok := scope.FieldByName(key.column)
+		if !ok {
+			return "", fmt.Errorf("paginating: unknown sort field %q", key.column)
+		}
+		value, err := json.Marshal(field.Field.Interface())
+		if err != nil {
+			return "", fmt.Errorf("encoding cursor: %w", err)
+		}
+		c.Values[i] = value
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("encoding cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the values of token typed as the fields of model, so
+// that e.g. times are compared as times rather than strings.
+func decodeCursor(db *gorm.DB, model interface{}, keys []sortKey, token string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Values) != len(keys) {
+		return nil, ErrInvalidCursor
+	}
+	if !reflect.DeepEqual(c.Keys, cursorKeys(keys)) {
+		return nil, fmt.Errorf("%w: issued for another sort order", ErrInvalidCursor)
+	}
+
+	scope := db.NewScope(model)
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		field, ok := scope.FieldByName(key.column)
+		if !ok {
+			return nil, fmt.Errorf("paginating: unknown sort field %q", key.column)
+		}
+		value := reflect.New(field.Field.Type())
+		if err := json.Unmarshal(c.Values[i], value.Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
@@ -0,0 +1,185 @@
+package goutils
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Pool settings used when the DatabaseConfig fields are zero. SQLite gets a
+// single connection that never expires instead, since it allows a single writer
+// and in-memory databases vanish with their last connection.
+const (
+	DefaultMaxOpenConns    = 25
+	DefaultMaxIdleConns    = 10
+	DefaultMaxConnLifetime = 30 * time.Minute
+	DefaultMaxConnIdleTime = 5 * time.Minute
+)
+
+type poolSettings struct {
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+	maxIdleTime time.Duration
+}
+
+// poolSettingsFor returns the pool settings of dbConfig, with defaults for the
+// zero fields.
+func poolSettingsFor(dbConfig *DatabaseConfig) poolSettings {
+	s := poolSettings{
+		maxOpen:     dbConfig.MaxOpenConns,
+		maxIdle:     dbConfig.MaxIdleConns,
+		maxLifetime: dbConfig.MaxConnLifetime,
+		maxIdleTime: dbConfig.MaxConnIdleTime,
+	}
+	sqlite := dbConfig.Type == SQLITE3
+	if s.maxOpen == 0 {
+		s.maxOpen = DefaultMaxOpenConns
+		if sqlite {
+			s.maxOpen = 1
+		}
+	}
+	if s.maxIdle == 0 {
+		s.maxIdle = DefaultMaxIdleConns
+	}
+	if s.maxIdle > s.maxOpen {
+		s.maxIdle = s.maxOpen
+	}
+	if s.maxLifetime == 0 && !sqlite {
+		s.maxLifetime = DefaultMaxConnLifetime
+	}
+	if s.maxIdleTime == 0 && !sqlite {
+		s.maxIdleTime = DefaultMaxConnIdleTime
+	}
+	return s
+}
+
+// PoolStats returns the statistics of the connected pool, or zero statistics
+// when Connect has not been called.
+func (c *DBConn) PoolStats() sql.DBStats {
+	db := c.DB()
+	if db == nil {
+		return sql.DBStats{}
+	}
+	return db.DB().Stats()
+}
+
+// PoolMonitorOptions configures MonitorPool. A nil *PoolMonitorOptions uses the defaults.
+type PoolMonitorOptions struct {
+	// Interval is how often the pool statistics are checked. Defaults to 30 seconds.
+	Interval time.Duration
+	// WaitDurationThreshold is the average wait for a connection, over an
+	// interval, from which a warning is logged. Defaults to 50ms.
+	WaitDurationThreshold time.Duration
+	// IdleClosedThreshold is the number of connections closed for lack of idle
+	// slots, over an interval, from which a warning is logged. Defaults to 10.
+	IdleClosedThreshold int64
+	// Adaptive adjusts the idle connections from the observed usage: they grow
+	// while connections are waited for or closed for lack of idle slots, and
+	// shrink towards the connections in use otherwise, between MinIdleConns and
+	// the open connections limit.
+	Adaptive     bool
+	MinIdleConns int
+}
+
+func (o *PoolMonitorOptions) withDefaults() PoolMonitorOptions {
+	var opts PoolMonitorOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+	if opts.WaitDurationThreshold <= 0 {
+		opts.WaitDurationThreshold = 50 * time.Millisecond
+	}
+	if opts.IdleClosedThreshold <= 0 {
+		opts.IdleClosedThreshold = 10
+	}
+	if opts.MinIdleConns <= 0 {
+		opts.MinIdleConns = 1
+	}
+	return opts
+}
+
+// MonitorPool checks the pool statistics every Interval until ctx is done,
+// logging a warning when connections are waited for or churned, which hints at
+// MaxOpenConns or MaxIdleConns being too low.
+func (c *DBConn) MonitorPool(ctx context.Context, opts *PoolMonitorOptions) {
+	o := opts.withDefaults()
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+
+	previous := c.PoolStats()
+	idle := poolSettingsFor(c.dbConfig).maxIdle
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		db := c.DB()
+		if db == nil {
+			continue
+		}
+		stats := db.DB().Stats()
+		if stats.WaitCount < previous.WaitCount || stats.MaxIdleClosed < previous.MaxIdleClosed {
+			// The pool was closed and connected again.
+			previous = sql.DBStats{}
+		}
+		waits := stats.WaitCount - previous.WaitCount
+		waited := stats.WaitDuration - previous.WaitDuration
+		idleClosed := stats.MaxIdleClosed - previous.MaxIdleClosed
+		previous = stats
+
+		logger := c.logger.WithField("in_use", stats.InUse).WithField("idle", stats.Idle).WithField("max_open", stats.MaxOpenConnections)
+		// WaitCount grows when a wait starts but WaitDuration when it ends, possibly
+		// in the next interval.
+		if waited > 0 && waited/time.Duration(max(waits, 1)) >= o.WaitDurationThreshold {
+			logger.WithField("wait_count", waits).WithField("wait_duration", waited).
+				Warn("queries are waiting for database connections, consider raising maxOpenConns")
+		}
+		if idleClosed >= o.IdleClosedThreshold {
+			logger.WithField("idle_closed", idleClosed).
+				Warn("database connections are closed for lack of idle slots, consider raising maxIdleConns")
+		}
+
+		if o.Adaptive {
+			target := adaptIdleConns(idle, stats, waits > 0 || waited > 0, idleClosed > 0, o.MinIdleConns)
+			if target != idle {
+				logger.WithField("from", idle).WithField("to", target).Info("adjusting idle database connections")
+				db.DB().SetMaxIdleConns(target)
+				idle = target
+			}
+		}
+	}
+}
+
+// adaptIdleConns doubles the idle connections under pressure and otherwise
+// lowers them by a quarter, never below the connections in use.
+func adaptIdleConns(idle int, stats sql.DBStats, waited, idleClosed bool, minIdle int) int {
+	maxIdle := stats.MaxOpenConnections
+	if maxIdle <= 0 {
+		maxIdle = 2 * DefaultMaxOpenConns
+	}
+	target := idle
+	switch {
+	case waited || idleClosed:
+		target = 2 * idle
+		if target == 0 {
+			target = 1
+		}
+	case stats.InUse < idle:
+		target = idle - (idle+3)/4
+		if target < stats.InUse {
+			target = stats.InUse
+		}
+	}
+	if target < minIdle {
+		target = minIdle
+	}
+	if target > maxIdle {
+		target = maxIdle
+	}
+	return target
+}
@@ -0,0 +1,230 @@
+package goutils
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProxyDirect can be used as ProxyRule.Proxy to send matching hosts without a proxy,
+// mirroring the DIRECT keyword of PAC files.
+const ProxyDirect = "DIRECT"
+
+// ProxyRule routes requests whose host matches one of Hosts through Proxy.
+// Host patterns follow the NO_PROXY conventions: "*" matches everything,
+// "example.com" matches the host and its subdomains, "*.example.com" and
+// ".example.com" match subdomains only, "host:port" restricts the port and
+// CIDR blocks such as "10.0.0.0/8" match IP literals.
+type ProxyRule struct {
+	Hosts []string
+	Proxy string
+}
+
+// ProxyConfig describes how an APIClient reaches the outside world.
+// Resolution order for a request is: NoProxy, Rules (first match wins),
+// URL and finally the HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment when
+// FromEnvironment is set. Requests matching nothing are sent directly.
+type ProxyConfig struct {
+	// URL is the default proxy, e.g. "http://proxy:3128" or "socks5://proxy:1080".
+	URL string
+	// FromEnvironment falls back to the standard proxy environment variables.
+	FromEnvironment bool
+	// Rules route specific hosts through specific proxies (or ProxyDirect).
+	Rules []ProxyRule
+	// NoProxy lists host patterns that always bypass the proxy.
+	NoProxy []string
+	// Username and Password authenticate against every configured proxy that
+	// does not carry its own credentials in the URL.
+	Username string
+	Password string
+}
+
+// ProxyFunc validates the configuration and returns a function suitable for
+// http.Transport.Proxy.
+func (p *ProxyConfig) ProxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	defaultProxy, err := p.parseProxyURL(p.URL)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]*url.URL, len(p.Rules))
+	for i, rule := range p.Rules {
+		if len(rule.Hosts) == 0 {
+			return nil, fmt.Errorf("proxy rule %d has no hosts", i)
+		}
+		if rules[i], err = p.parseProxyURL(rule.Proxy); err != nil {
+			return nil, fmt.Errorf("proxy rule %d: %w", i, err)
+		}
+	}
+
+	noProxy := append([]string(nil), p.NoProxy...)
+	hosts := make([][]string, len(p.Rules))
+	for i, rule := range p.Rules {
+		hosts[i] = append([]string(nil), rule.Hosts...)
+	}
+	fromEnvironment := p.FromEnvironment
+
+	return func(req *http.Request) (*url.URL, error) {
+		host, port := req.URL.Hostname(), requestPort(req.URL)
+		if matchProxyHosts(noProxy, host, port) {
+			return nil, nil
+		}
+		for i, rule := range hosts {
+			if matchProxyHosts(rule, host, port) {
+				return rules[i], nil
+			}
+		}
+		if defaultProxy != nil {
+			return defaultProxy, nil
+		}
+		if fromEnvironment {
+			return http.ProxyFromEnvironment(req)
+		}
+		return nil, nil
+	}, nil
+}
+
+// parseProxyURL parses a proxy URL, returning nil for an empty value or ProxyDirect.
+func (p *ProxyConfig) parseProxyURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.EqualFold(raw, ProxyDirect) {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy url %q has no host", raw)
+	}
+	if u.User == nil && p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+	return u, nil
+}
+
+func requestPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch u.Scheme {
+	case "https":
+		return "443"
+	case "http":
+		return "80"
+	}
+	return ""
+}
+
+func matchProxyHosts(patterns []string, host, port string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range patterns {
+		if matchProxyHost(strings.ToLower(strings.TrimSpace(pattern)), host, port) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchProxyHost(pattern, host, port string) bool {
+	if pattern == "" {
+		return false
+	}
+	if pattern == "*" {
+		return true
+	}
+	if _, cidr, err := net.ParseCIDR(pattern); err == nil {
+		ip := net.ParseIP(host)
+		return ip != nil && cidr.Contains(ip)
+	}
+	if h, p, err := net.SplitHostPort(pattern); err == nil {
+		if p != port {
+			return false
+		}
+		pattern = h
+	}
+	pattern = strings.Trim(pattern, "[]")
+	switch {
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(host, pattern[1:])
+	case strings.HasPrefix(pattern, "."):
+		return strings.HasSuffix(host, pattern)
+	default:
+		return host == pattern || strings.HasSuffix(host, "."+pattern)
+	}
+}
+
+// SetProxy gives c its own transport routed according to config, keeping the
+// debugging enabled on c or globally. The global http.DefaultClient and
+// http.DefaultTransport are left untouched.
+func (c *APIClient) SetProxy(config *ProxyConfig) error {
+	proxy, err := config.ProxyFunc()
+	if err != nil {
+		return err
+	}
+	var rt http.RoundTripper = newTransport()
+	if c.client != nil && c.client.Transport != nil {
+		rt = c.client.Transport
+	} else if d, ok := http.DefaultTransport.(*debugRoundTripper); ok {
+		rt = &debugRoundTripper{rt: rt, opts: d.opts}
+	}
+	transport, err := withProxy(rt, proxy)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{}
+	if c.client != nil {
+		*client = *c.client
+	}
+	client.Transport = transport
+	c.client = client
+	return nil
+}
+
+// withProxy returns a copy of rt routed through proxy, with the same debugging.
+func withProxy(rt http.RoundTripper, proxy func(*http.Request) (*url.URL, error)) (http.RoundTripper, error) {
+	switch t := rt.(type) {
+	case *debugRoundTripper:
+		inner, err := withProxy(t.rt, proxy)
+		if err != nil {
+			return nil, err
+		}
+		return &debugRoundTripper{rt: inner, opts: t.opts}, nil
+	case *http.Transport:
+		transport := t.Clone()
+		transport.Proxy = proxy
+		return transport, nil
+	}
+	return nil, fmt.Errorf("setting proxy: unsupported transport %T", rt)
+}
+
+// newTransport returns a transport with the same settings as http.DefaultTransport,
+// even when the latter has been replaced by a wrapping RoundTripper.
+func newTransport() *http.Transport {
+	rt := http.DefaultTransport
+	if d, ok := rt.(*debugRoundTripper); ok {
+		rt = d.rt
+	}
+	if t, ok := rt.(*http.Transport); ok {
+		return t.Clone()
+	}
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
@@ -0,0 +1,115 @@
+package goutils
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+// QueryLogOptions controls what EnableQueryLogging logs. Failed queries are logged
+// at error level, slow queries at warn level and a sample of the others at debug
+// level, all through Logger.
+type QueryLogOptions struct {
+	Logger *Logger
+	// SlowThreshold is the duration from which a query is logged as slow.
+	// Defaults to DefaultSlowQueryThreshold.
+	SlowThreshold time.Duration
+	// SampleRate is the fraction, between 0 and 1, of other queries that are logged.
+	SampleRate float64
+	// LogParameters logs the bound parameters of queries. They are replaced by
+	// RedactionMask otherwise, since they commonly hold personal data.
+	LogParameters bool
+	RedactionMask string
+}
+
+func DefaultQueryLogOptions() *QueryLogOptions {
+	return &QueryLogOptions{
+		Logger:        NewLogger(),
+		SlowThreshold: DefaultSlowQueryThreshold,
+		RedactionMask: DefaultRedactionMask,
+	}
+}
+
+// EnableQueryLogging registers gorm callbacks logging the queries run through db.
+// Calling it again replaces the options.
+func EnableQueryLogging(db *gorm.DB, opts *QueryLogOptions) {
+	o := *opts
+	if o.Logger == nil {
+		o.Logger = NewLogger()
+	}
+	if o.SlowThreshold <= 0 {
+		o.SlowThreshold = DefaultSlowQueryThreshold
+	}
+	if o.RedactionMask == "" {
+		o.RedactionMask = DefaultRedactionMask
+	}
+	observeQueries(db, "querylog", func(scope *gorm.Scope, operation string, elapsed time.Duration) {
+		logQuery(&o, scope, operation, elapsed)
+	})
+}
+
+func logQuery(opts *QueryLogOptions, scope *gorm.Scope, operation string, elapsed time.Duration) {
+	err := queryError(scope)
+	slow := elapsed >= opts.SlowThreshold
+	if err == nil && !slow && (opts.SampleRate <= 0 || rand.Float64() >= opts.SampleRate) {
+		return
+	}
+
+	entry := opts.Logger.WithFields(logrus.Fields{
+		"operation":     operation,
+		"table":         queryTable(scope),
+		"duration":      elapsed,
+		"rows_affected": scope.DB().RowsAffected,
+		"caller":        queryCaller(),
+		"sql":           strings.TrimSpace(scope.SQL),
+	})
+	if len(scope.SQLVars) > 0 {
+		entry = entry.WithField("params", queryParams(scope.SQLVars, opts))
+	}
+
+	switch {
+	case err != nil:
+		entry.WithError(err).Error("query failed")
+	case slow:
+		entry.WithField("threshold", opts.SlowThreshold).Warn("slow query")
+	default:
+		entry.Debug("query")
+	}
+}
+
+func queryParams(vars []interface{}, opts *QueryLogOptions) []string {
+	params := make([]string, len(vars))
+	for i, v := range vars {
+		if opts.LogParameters {
+			params[i] = fmt.Sprint(v)
+		} else {
+			params[i] = opts.RedactionMask
+		}
+	}
+	return params
+}
+
+// queryCaller returns the file and line of the first frame outside gorm, this
+// package and the runtime.
+func queryCaller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/jinzhu/gorm") &&
+			!strings.HasPrefix(frame.Function, "github.com/RamanPndy/go-utils/utils.") &&
+			!strings.HasPrefix(frame.Function, "runtime.") &&
+			!strings.HasPrefix(frame.Function, "reflect.") {
+			return fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(frame.File)), filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
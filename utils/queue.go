@@ -0,0 +1,468 @@
+package goutils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DefaultJobTable is the table used when JobQueueOptions.Table is not set.
+const DefaultJobTable = "jobs"
+
+type JobState string
+
+const (
+	JobPending   JobState = "pending"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	// JobDead is the dead-letter state of the jobs that failed MaxAttempts times.
+	JobDead JobState = "dead"
+)
+
+// ErrDuplicateJob is returned by Enqueue when a pending or running job has the
+// same unique key.
+var ErrDuplicateJob = errors.New("a job with the same unique key is already queued")
+
+// Job is a row of the job table.
+type Job struct {
+	ID       uint64 `gorm:"primary_key"`
+	Queue    string `gorm:"not null;index"`
+	Payload  []byte
+	Priority int      `gorm:"not null;default:0"`
+	State    JobState `gorm:"not null;index"`
+	// UniqueKey is cleared once the job is finished, so that it can be reused.
+	UniqueKey   *string   `gorm:"unique_index"`
+	Attempts    int       `gorm:"not null;default:0"`
+	MaxAttempts int       `gorm:"not null"`
+	LastError   string    `gorm:"type:text"`
+	RunAt       time.Time `gorm:"not null;index"`
+	// LockedBy and LockedUntil hold the lease of the worker running the job.
+	LockedBy    string
+	LockedUntil *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	FinishedAt  *time.Time
+}
+
+// JobHandler runs a job. The job is retried when it returns an error. ctx is
+// cancelled when the worker shuts down or loses the lease of the job.
+type JobHandler func(ctx context.Context, job *Job) error
+
+// EnqueueOptions configures a job. A nil *EnqueueOptions uses the defaults.
+type EnqueueOptions struct {
+	// Priority orders the jobs that are due, highest first.
+	Priority int
+	// RunAt delays the job. Defaults to now.
+	RunAt time.Time
+	// UniqueKey rejects the job with ErrDuplicateJob while another unfinished job
+	// has the same key.
+	UniqueKey string
+	// MaxAttempts defaults to JobQueueOptions.MaxAttempts.
+	MaxAttempts int
+}
+
+// JobQueueOptions configures a JobQueue. A nil *JobQueueOptions uses the defaults.
+type JobQueueOptions struct {
+	// Table defaults to DefaultJobTable.
+	Table  string
+	Logger *Logger
+	// Concurrency is the number of jobs Run runs at once. Defaults to 1.
+	Concurrency int
+	// PollInterval is the wait between polls when no job is due. Defaults to 1 second.
+	PollInterval time.Duration
+	// VisibilityTimeout is the lease of a worker on a job, renewed while it runs.
+	// A job whose lease expired, e.g. because its worker died, is run again.
+	// Defaults to 5 minutes.
+	VisibilityTimeout time.Duration
+	// InitialBackoff and MaxBackoff bound the jittered exponential delay before a
+	// failed job is retried. They default to 1s and 1h.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxAttempts is the default number of attempts after which a job is dead.
+	// Defaults to 25.
+	MaxAttempts int
+	// ShutdownTimeout is how long Run waits for the running jobs once its context
+	// is done before cancelling them. Defaults to 30 seconds.
+	ShutdownTimeout time.Duration
+}
+
+func (o *JobQueueOptions) withDefaults() JobQueueOptions {
+	var opts JobQueueOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.Table == "" {
+		opts.Table = DefaultJobTable
+	}
+	if opts.Logger == nil {
+		opts.Logger = NewLogger()
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 5 * time.Minute
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Hour
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 25
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = 30 * time.Second
+	}
+	return opts
+}
+
+// JobQueue is a job queue stored in a database table. Workers of several
+// processes can share it: on Postgres and MySQL 8 jobs are claimed with FOR
+// UPDATE SKIP LOCKED, on SQLite with a conditional update.
+type JobQueue struct {
+	db   func() *gorm.DB
+	opts JobQueueOptions
+
+	mu       sync.Mutex
+	handlers map[string]JobHandler
+}
+
+func NewJobQueue(db *gorm.DB, opts *JobQueueOptions) *JobQueue {
+	return &JobQueue{db: func() *gorm.DB { return db }, opts: opts.withDefaults(), handlers: make(map[string]JobHandler)}
+}
+
+// NewJobQueue returns a JobQueue using the pool of c, following its credential
+// rotations. Connect must have been called.
+func (c *DBConn) NewJobQueue(opts *JobQueueOptions) *JobQueue {
+	return &JobQueue{db: c.DB, opts: opts.withDefaults(), handlers: make(map[string]JobHandler)}
+}
+
+func (q *JobQueue) table(db *gorm.DB) *gorm.DB {
+	return db.Table(q.opts.Table)
+}
+
+// Migrate creates or updates the job table.
+func (q *JobQueue) Migrate() error {
+	return q.table(q.db()).AutoMigrate(&Job{}).Error
+}
+
+// Enqueue adds a job to queue through tx, which may be a transaction so that the
+// job is only queued if it commits.
+func (q *JobQueue) Enqueue(ctx context.Context, tx *gorm.DB, queue string, payload []byte, opts *EnqueueOptions) (*Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if queue == "" {
+		return nil, errors.New("enqueueing job: empty queue")
+	}
+	var o EnqueueOptions
+	if opts != nil {
+		o = *opts
+	}
+	job := &Job{
+		Queue:       queue,
+		Payload:     payload,
+		Priority:    o.Priority,
+		State:       JobPending,
+		MaxAttempts: o.MaxAttempts,
+		RunAt:       o.RunAt,
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = q.opts.MaxAttempts
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = gorm.NowFunc()
+	}
+
+	db := q.table(tx)
+	if o.UniqueKey != "" {
+		job.UniqueKey = &o.UniqueKey
+		clause, err := upsertClause(tx.Dialect(), []string{"unique_key"}, nil)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Set("gorm:insert_option", clause)
+	}
+	result := db.Create(job)
+	// Postgres returns no row from DO NOTHING.
+	if errors.Is(result.Error, sql.ErrNoRows) || (result.Error == nil && result.RowsAffected == 0) {
+		return nil, ErrDuplicateJob
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("enqueueing job: %w", result.Error)
+	}
+	return job, nil
+}
+
+// EnqueueJSON is like Enqueue with v encoded as JSON.
+func (q *JobQueue) EnqueueJSON(ctx context.Context, tx *gorm.DB, queue string, v interface{}, opts *EnqueueOptions) (*Job, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("enqueueing job: %w", err)
+	}
+	return q.Enqueue(ctx, tx, queue, payload, opts)
+}
+
+// Handle registers the handler of the jobs of queue. Run only claims jobs of
+// queues with a handler.
+func (q *JobQueue) Handle(queue string, handler JobHandler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[queue] = handler
+}
+
+func (q *JobQueue) handler(queue string) JobHandler {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.handlers[queue]
+}
+
+// Run runs jobs with Concurrency workers until ctx is done, then waits up to
+// ShutdownTimeout for the running jobs before cancelling them. Cancelled jobs are
+// put back in the queue without counting the attempt.
+func (q *JobQueue) Run(ctx context.Context) error {
+	q.mu.Lock()
+	queues := make([]string, 0, len(q.handlers))
+	for queue := range q.handlers {
+		queues = append(queues, queue)
+	}
+	q.mu.Unlock()
+	if len(queues) == 0 {
+		return errors.New("running jobs: no handler registered")
+	}
+	sort.Strings(queues)
+
+	host, _ := os.Hostname()
+	prefix := fmt.Sprintf("%s-%d-%06x", host, os.Getpid(), rand.Intn(1<<24))
+	var wg sync.WaitGroup
+	for i := 0; i < q.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func(worker string) {
+			defer wg.Done()
+			q.work(ctx, worker, queues)
+		}(fmt.Sprintf("%s-%d", prefix, i))
+	}
+	wg.Wait()
+	return nil
+}
+
+func (q *JobQueue) work(ctx context.Context, worker string, queues []string) {
+	for ctx.Err() == nil {
+		job, err := q.claim(ctx, worker, queues)
+		if err != nil && ctx.Err() == nil {
+			q.opts.Logger.WithError(err).WithField("worker", worker).Error("failed to claim a job")
+		}
+		if job == nil {
+			sleepContext(ctx, q.opts.PollInterval)
+			continue
+		}
+		q.run(ctx, worker, job)
+	}
+}
+
+// claimable selects the jobs that are due and those whose lease expired.
+const claimable = "queue IN (?) AND ((state = ? AND run_at <= ?) OR (state = ? AND locked_until < ?))"
+
+// claim leases the next due job of queues to worker, or returns nil if none is due.
+func (q *JobQueue) claim(ctx context.Context, worker string, queues []string) (*Job, error) {
+	db := q.db()
+	if db == nil {
+		return nil, errors.New("claiming job: not connected")
+	}
+
+	var claimed *Job
+	claimFrom := func(tx *gorm.DB) error {
+		claimed = nil
+		for ctx.Err() == nil {
+			now := gorm.NowFunc()
+			args := []interface{}{queues, JobPending, now, JobRunning, now}
+			query := q.table(tx).Where(claimable, args...).Order("priority DESC, run_at, id").Limit(1)
+			if name := tx.Dialect().GetName(); name == POSTGRESQL || name == MYSQL {
+				query = query.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED")
+			}
+			var jobs []*Job
+			if err := query.Find(&jobs).Error; err != nil {
+				return err
+			}
+			if len(jobs) == 0 {
+				return nil
+			}
+			job := jobs[0]
+
+			updates := map[string]interface{}{
+				"state":        JobRunning,
+				"attempts":     job.Attempts + 1,
+				"locked_by":    worker,
+				"locked_until": now.Add(q.opts.VisibilityTimeout),
+			}
+			if job.State == JobRunning && job.Attempts >= job.MaxAttempts {
+				// Its worker died or hung on the last attempt.
+				updates = map[string]interface{}{
+					"state":        JobDead,
+					"last_error":   "visibility timeout expired",
+					"finished_at":  now,
+					"unique_key":   nil,
+					"locked_by":    "",
+					"locked_until": nil,
+				}
+			}
+			// The condition makes the update fail if another worker claimed the job
+			// meanwhile, which can only happen on SQLite.
+			result := q.table(tx).Where("id = ? AND attempts = ?", job.ID, job.Attempts).Where(claimable, args...).UpdateColumns(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 || updates["state"] == JobDead {
+				continue
+			}
+			job.State, job.Attempts, job.LockedBy = JobRunning, job.Attempts+1, worker
+			lockedUntil := now.Add(q.opts.VisibilityTimeout)
+			job.LockedUntil = &lockedUntil
+			claimed = job
+			return nil
+		}
+		return ctx.Err()
+	}
+
+	var err error
+	if db.Dialect().GetName() == SQLITE3 {
+		// SQLite fails concurrent transactions upgrading their read lock, and
+		// serializes the statements anyway.
+		err = claimFrom(db)
+	} else {
+		err = WithTransaction(ctx, db, nil, claimFrom)
+	}
+	return claimed, err
+}
+
+// run runs job, renewing its lease, and records the outcome.
+func (q *JobQueue) run(ctx context.Context, worker string, job *Job) {
+	logger := q.opts.Logger.WithField("job_id", job.ID).WithField("queue", job.Queue).WithField("attempt", job.Attempts)
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	var leaseLost atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		renew := time.NewTicker(q.opts.VisibilityTimeout / 2)
+		defer renew.Stop()
+		shutdown := ctx.Done()
+		var deadline <-chan time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case <-shutdown:
+				shutdown = nil
+				deadline = time.After(q.opts.ShutdownTimeout)
+			case <-deadline:
+				logger.Warn("cancelling job after the shutdown timeout")
+				cancel()
+				return
+			case <-renew.C:
+				lockedUntil := gorm.NowFunc().Add(q.opts.VisibilityTimeout)
+				result := q.table(q.db()).Where("id = ? AND locked_by = ?", job.ID, worker).UpdateColumn("locked_until", lockedUntil)
+				if result.Error != nil {
+					logger.WithError(result.Error).Warn("failed to renew the job lease")
+				} else if result.RowsAffected == 0 {
+					logger.Error("lost the job lease, cancelling the job")
+					leaseLost.Store(true)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	start := time.Now()
+	err := q.call(jobCtx, job)
+	close(done)
+	logger = logger.WithField("duration", time.Since(start))
+	if leaseLost.Load() {
+		return
+	}
+
+	now := gorm.NowFunc()
+	updates := map[string]interface{}{"locked_by": "", "locked_until": nil}
+	switch {
+	case err == nil:
+		updates["state"], updates["finished_at"], updates["unique_key"] = JobSucceeded, now, nil
+		logger.Debug("job succeeded")
+	case jobCtx.Err() != nil && ctx.Err() != nil:
+		// Interrupted by the shutdown: the attempt does not count.
+		updates["state"], updates["run_at"], updates["attempts"] = JobPending, now, job.Attempts-1
+		updates["last_error"] = err.Error()
+		logger.WithError(err).Warn("job interrupted by shutdown, requeued")
+	case job.Attempts >= job.MaxAttempts:
+		updates["state"], updates["finished_at"], updates["unique_key"] = JobDead, now, nil
+		updates["last_error"] = err.Error()
+		logger.WithError(err).Error("job failed for the last time, moved to the dead-letter state")
+	default:
+		retryAt := now.Add(backoff{initial: q.opts.InitialBackoff, max: q.opts.MaxBackoff}.delay(job.Attempts - 1))
+		updates["state"], updates["run_at"], updates["last_error"] = JobPending, retryAt, err.Error()
+		logger.WithError(err).WithField("retry_at", retryAt).Warn("job failed")
+	}
+	result := q.table(q.db()).Where("id = ? AND locked_by = ?", job.ID, worker).UpdateColumns(updates)
+	if result.Error != nil {
+		logger.WithError(result.Error).Error("failed to record the job outcome")
+	}
+}
+
+// call runs the handler of job, turning panics into errors.
+func (q *JobQueue) call(ctx context.Context, job *Job) (err error) {
+	handler := q.handler(job.Queue)
+	if handler == nil {
+		return fmt.Errorf("no handler for queue %q", job.Queue)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// Requeue moves a dead job back to the pending state with its attempts reset.
+func (q *JobQueue) Requeue(ctx context.Context, id uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	result := q.table(q.db()).Where("id = ? AND state = ?", id, JobDead).UpdateColumns(map[string]interface{}{
+		"state":       JobPending,
+		"attempts":    0,
+		"run_at":      gorm.NowFunc(),
+		"finished_at": nil,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &NotFoundError{Entity: "dead job", Key: id}
+	}
+	return nil
+}
+
+// PurgeSucceeded deletes the jobs that succeeded before olderThan ago and returns
+// how many were deleted. Dead jobs are kept for inspection.
+func (q *JobQueue) PurgeSucceeded(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	result := q.table(q.db()).Where("state = ? AND finished_at < ?", JobSucceeded, gorm.NowFunc().Add(-olderThan)).Delete(&Job{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,96 @@
+package goutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// WaitReadyOptions controls how WaitReady retries. A nil *WaitReadyOptions uses the defaults.
+type WaitReadyOptions struct {
+	// InitialBackoff and MaxBackoff bound the jittered exponential delay between
+	// attempts. They default to 100ms and 5s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// PingTimeout bounds each attempt. Defaults to 5 seconds.
+	PingTimeout time.Duration
+	// MaxAttempts stops retrying after that many attempts. Zero retries until ctx is done.
+	MaxAttempts int
+}
+
+func (o *WaitReadyOptions) withDefaults() WaitReadyOptions {
+	var opts WaitReadyOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Second
+	}
+	if opts.PingTimeout <= 0 {
+		opts.PingTimeout = 5 * time.Second
+	}
+	return opts
+}
+
+// IsDBAuthError reports whether err means that the database rejected the
+// credentials, which retrying cannot fix.
+func IsDBAuthError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 28: invalid authorization specification.
+		return pqErr.Code.Class() == "28"
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// ER_DBACCESS_DENIED_ERROR, ER_ACCESS_DENIED_ERROR, ER_ACCESS_DENIED_NO_PASSWORD_ERROR
+		return mysqlErr.Number == 1044 || mysqlErr.Number == 1045 || mysqlErr.Number == 1698
+	}
+	return false
+}
+
+// WaitReady pings the database until it answers, retrying with backoff. It uses
+// the connected pool, or a single temporary pool for all attempts when Connect
+// has not been called. Authentication errors are returned at once.
+func (c *DBConn) WaitReady(ctx context.Context, opts *WaitReadyOptions) error {
+	o := opts.withDefaults()
+	db, release, err := c.sqlDB()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	b := backoff{initial: o.InitialBackoff, max: o.MaxBackoff}
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, o.PingTimeout)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			c.logger.WithField("attempts", attempt).WithField("waited", time.Since(start)).Info("database is ready")
+			return nil
+		}
+
+		logger := c.logger.WithError(err).WithField("attempt", attempt)
+		if IsDBAuthError(err) {
+			logger.Error("database rejected the credentials")
+			return fmt.Errorf("waiting for database: %w", err)
+		}
+		if o.MaxAttempts > 0 && attempt >= o.MaxAttempts {
+			logger.Error("database is still unreachable, giving up")
+			return fmt.Errorf("waiting for database: giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := b.delay(attempt - 1)
+		logger.WithField("retry_in", delay).Warn("database is not ready")
+		if ctxErr := sleepContext(ctx, delay); ctxErr != nil {
+			return fmt.Errorf("waiting for database: %w (last error: %v)", ctxErr, err)
+		}
+	}
+}
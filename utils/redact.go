@@ -0,0 +1,191 @@
+package goutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const DefaultRedactionMask = "[REDACTED]"
+
+var (
+	DefaultRedactedHeaders     = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token"}
+	DefaultRedactedJSONFields  = []string{"password", "secret", "token", "access_token", "refresh_token", "client_secret", "api_key"}
+	DefaultRedactedQueryParams = []string{"token", "access_token", "api_key", "key", "signature", "password"}
+)
+
+// RedactHeaders returns a copy of header with the values of names replaced by mask.
+// Header names are matched case-insensitively.
+func RedactHeaders(header http.Header, names []string, mask string) http.Header {
+	redacted := header.Clone()
+	for key := range redacted {
+		if containsFold(names, key) {
+			redacted[key] = []string{mask}
+		}
+	}
+	return redacted
+}
+
+// RedactURL returns u as a string with the password and the values of the given
+// query parameters replaced by mask.
+func RedactURL(u *url.URL, params []string, mask string) string {
+	if u == nil {
+		return ""
+	}
+	redacted := *u
+	if _, ok := redacted.User.Password(); ok {
+		redacted.User = url.UserPassword(redacted.User.Username(), mask)
+	}
+	if redacted.RawQuery != "" {
+		redacted.RawQuery = redactQuery(redacted.RawQuery, params, mask)
+	}
+	return redacted.String()
+}
+
+// RedactJSON replaces the values of the given object fields, at any depth, by mask.
+// Field names are matched case-insensitively. If body is not valid JSON (e.g. it
+// was truncated) string and scalar values of the fields are redacted textually.
+func RedactJSON(body []byte, fields []string, mask string) []byte {
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return redactJSONText(body, fields, mask)
+	}
+	out, err := json.Marshal(redactJSONValue(doc, fields, mask))
+	if err != nil {
+		return redactJSONText(body, fields, mask)
+	}
+	return out
+}
+
+func redactJSONValue(v any, fields []string, mask string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if containsFold(fields, key) {
+				v[key] = mask
+			} else {
+				v[key] = redactJSONValue(value, fields, mask)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactJSONValue(value, fields, mask)
+		}
+	}
+	return v
+}
+
+func redactJSONText(body []byte, fields []string, mask string) []byte {
+	if len(fields) == 0 {
+		return body
+	}
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = regexp.QuoteMeta(f)
+	}
+	re := regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	return re.ReplaceAll(body, []byte(`${1}"`+mask+`"`))
+}
+
+func redactQuery(rawQuery string, params []string, mask string) string {
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		key, _, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		if name, err := url.QueryUnescape(key); err == nil && containsFold(params, name) {
+			parts[i] = key + "=" + url.QueryEscape(mask)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// IsBinaryBody reports whether body looks like binary content that should not be logged.
+func IsBinaryBody(contentType string, body []byte) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "xml"),
+		mediaType == string(ApplicationFormURLEncoded):
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"),
+		mediaType == "application/octet-stream",
+		mediaType == "application/pdf",
+		mediaType == "application/zip",
+		mediaType == "application/gzip",
+		mediaType == "application/x-protobuf",
+		mediaType == "application/grpc":
+		return true
+	}
+	return !validUTF8Prefix(body) || bytes.IndexByte(body, 0) >= 0
+}
+
+// validUTF8Prefix is utf8.Valid tolerating a multi-byte rune cut by truncation.
+func validUTF8Prefix(b []byte) bool {
+	for i := 0; i < utf8.UTFMax && len(b) > 0; i++ {
+		if utf8.Valid(b) {
+			return true
+		}
+		b = b[:len(b)-1]
+	}
+	return utf8.Valid(b)
+}
+
+func looksLikeJSON(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatBody prepares body for logging: binary content is summarised, JSON and
+// form fields are redacted and the result is truncated to opts.MaxBodyBytes.
+func formatBody(contentType string, body []byte, total int64, opts *DebugOptions) string {
+	if len(body) == 0 {
+		return ""
+	}
+	truncated := total > int64(len(body))
+	if IsBinaryBody(contentType, body) {
+		if total < 0 {
+			return "<binary body>"
+		}
+		return fmt.Sprintf("<binary body, %d bytes>", total)
+	}
+
+	mediaType := strings.ToLower(strings.Split(contentType, ";")[0])
+	switch {
+	case strings.HasSuffix(mediaType, "json") || (mediaType == "" && looksLikeJSON(body)):
+		body = RedactJSON(body, opts.RedactJSONFields, opts.RedactionMask)
+	case mediaType == string(ApplicationFormURLEncoded):
+		body = []byte(redactQuery(string(body), opts.RedactJSONFields, opts.RedactionMask))
+	}
+
+	if opts.MaxBodyBytes > 0 && len(body) > opts.MaxBodyBytes {
+		body, truncated = body[:opts.MaxBodyBytes], true
+	}
+	if truncated {
+		if total < 0 {
+			return string(body) + "... (truncated)"
+		}
+		return fmt.Sprintf("%s... (truncated, %d bytes total)", body, total)
+	}
+	return string(body)
+}
@@ -0,0 +1,278 @@
+package goutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ReplicaRoundRobin       = "round-robin"
+	ReplicaLeastConnections = "least-connections"
+)
+
+// ReplicaConfig describes a read replica. Empty fields are inherited from the
+// primary DatabaseConfig, except DSN which, when set, replaces all of them.
+type ReplicaConfig struct {
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+	DSN      string `json:"dsn"`
+}
+
+// ReplicatedDB routes reads to healthy replicas and writes and transactions to
+// the primary. Replicas failing their Ready check are skipped until they pass it
+// again; reads fall back to the primary when no replica is healthy.
+type ReplicatedDB struct {
+	conn     *DBConn
+	primary  *gorm.DB
+	replicas []*replica
+	policy   string
+	logger   *logrus.Logger
+	next     uint64
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+type replica struct {
+	conn    *DBConn
+	name    string
+	mu      sync.RWMutex
+	db      *gorm.DB
+	healthy bool
+}
+
+// ConnectReplicated opens the primary and every replica in DatabaseConfig.Replicas
+// and starts checking replica health in the background. Replicas that cannot be
+// reached yet are connected once they pass a health check. Calling it again
+// closes the replica pools of the previous ReplicatedDB.
+func (c *DBConn) ConnectReplicated() (*ReplicatedDB, error) {
+	policy := c.dbConfig.ReplicaPolicy
+	if policy == "" {
+		policy = ReplicaRoundRobin
+	}
+	if policy != ReplicaRoundRobin && policy != ReplicaLeastConnections {
+		return nil, fmt.Errorf("unsupported replica policy %q", policy)
+	}
+	primary, err := c.Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ReplicatedDB{
+		conn:    c,
+		primary: primary,
+		policy:  policy,
+		logger:  c.logger,
+		stop:    make(chan struct{}),
+	}
+	var conns []*DBConn
+	for i, cfg := range c.dbConfig.Replicas {
+		conn, _ := NewDBConn(replicaDatabaseConfig(c.dbConfig, i, cfg), c.logger)
+		conns = append(conns, conn)
+		rep := &replica{conn: conn, name: replicaName(i, cfg)}
+		if db, err := conn.Connect(); err != nil {
+			c.logger.WithError(err).WithField("replica", rep.name).Warn("replica unavailable, reads will skip it")
+		} else {
+			rep.db, rep.healthy = db, true
+		}
+		r.replicas = append(r.replicas, rep)
+	}
+	c.mu.Lock()
+	previous := c.replicas
+	c.replicas = conns
+	c.mu.Unlock()
+	for _, conn := range previous {
+		if db := conn.DB(); db != nil {
+			conn.Close(db)
+		}
+	}
+
+	interval := c.dbConfig.ReplicaHealthCheckInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	if len(r.replicas) > 0 {
+		r.wg.Add(1)
+		go r.healthLoop(interval)
+	}
+	return r, nil
+}
+
+// replicaDatabaseConfig derives the configuration of the i-th replica. Its metrics
+// are labelled apart from the primary's, and the primary's password sources are
+// dropped when the replica has its own password or DSN.
+func replicaDatabaseConfig(primary *DatabaseConfig, i int, cfg ReplicaConfig) *DatabaseConfig {
+	replicaConfig := *primary
+	replicaConfig.Replicas = nil
+	replicaConfig.MetricsName = fmt.Sprintf("%s-replica-%d", metricsName(primary), i)
+	replicaConfig.DSN = cfg.DSN
+	replicaConfig.DSNFile, replicaConfig.DSNEnv = "", ""
+	if cfg.Password != "" || cfg.DSN != "" {
+		replicaConfig.PasswordFile, replicaConfig.PasswordEnv = "", ""
+	}
+	if cfg.Address != "" {
+		replicaConfig.Address = cfg.Address
+	}
+	if cfg.Port != 0 {
+		replicaConfig.Port = cfg.Port
+	}
+	if cfg.User != "" {
+		replicaConfig.User = cfg.User
+	}
+	if cfg.Password != "" {
+		replicaConfig.Password = cfg.Password
+	}
+	if cfg.Name != "" {
+		replicaConfig.Name = cfg.Name
+	}
+	if cfg.DSN == "" && primary.Type == HOTLOADDBType {
+		// Hotload DSNs cannot be built from fields.
+		replicaConfig.DSN = primary.DSN
+	}
+	return &replicaConfig
+}
+
+func replicaName(i int, cfg ReplicaConfig) string {
+	switch {
+	case cfg.Address != "":
+		return cfg.Address
+	case cfg.Name != "":
+		return cfg.Name
+	}
+	return fmt.Sprintf("replica-%d", i)
+}
+
+// Writer returns the primary.
+func (r *ReplicatedDB) Writer() *gorm.DB {
+	return r.primary
+}
+
+// Reader returns a healthy replica chosen by the replica policy, or the primary
+// when none is available.
+func (r *ReplicatedDB) Reader() *gorm.DB {
+	var healthy []*gorm.DB
+	for _, rep := range r.replicas {
+		rep.mu.RLock()
+		if rep.healthy {
+			healthy = append(healthy, rep.db)
+		}
+		rep.mu.RUnlock()
+	}
+	if len(healthy) == 0 {
+		return r.primary
+	}
+
+	if r.policy == ReplicaLeastConnections {
+		best := healthy[0]
+		bestInUse := best.DB().Stats().InUse
+		for _, db := range healthy[1:] {
+			if inUse := db.DB().Stats().InUse; inUse < bestInUse {
+				best, bestInUse = db, inUse
+			}
+		}
+		return best
+	}
+	n := atomic.AddUint64(&r.next, 1) - 1
+	return healthy[n%uint64(len(healthy))]
+}
+
+// Transaction runs fn in a transaction on the primary. See WithTransaction.
+func (r *ReplicatedDB) Transaction(ctx context.Context, opts *TxOptions, fn func(tx *gorm.DB) error) error {
+	return WithTransaction(ctx, r.primary, opts, fn)
+}
+
+// HealthyReplicas returns the number of replicas currently serving reads.
+func (r *ReplicatedDB) HealthyReplicas() int {
+	count := 0
+	for _, rep := range r.replicas {
+		rep.mu.RLock()
+		if rep.healthy {
+			count++
+		}
+		rep.mu.RUnlock()
+	}
+	return count
+}
+
+// CheckHealth runs the Ready check of every replica, removing failing replicas
+// from the read pool and restoring those that recovered.
+func (r *ReplicatedDB) CheckHealth() {
+	for _, rep := range r.replicas {
+		r.checkReplica(rep)
+	}
+}
+
+func (r *ReplicatedDB) checkReplica(rep *replica) {
+	logger := r.logger.WithField("replica", rep.name)
+	err := rep.conn.Ready()
+
+	rep.mu.RLock()
+	db, healthy := rep.db, rep.healthy
+	rep.mu.RUnlock()
+
+	if err != nil {
+		if healthy {
+			logger.WithError(err).Warn("replica failed health check, removing it from the read pool")
+			rep.mu.Lock()
+			rep.healthy = false
+			rep.mu.Unlock()
+		}
+		return
+	}
+	if healthy {
+		return
+	}
+	if db == nil {
+		if db, err = rep.conn.Connect(); err != nil {
+			logger.WithError(err).Warn("failed to connect to recovered replica")
+			return
+		}
+	}
+	logger.Info("replica recovered, adding it back to the read pool")
+	rep.mu.Lock()
+	rep.db, rep.healthy = db, true
+	rep.mu.Unlock()
+}
+
+func (r *ReplicatedDB) healthLoop(interval time.Duration) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.CheckHealth()
+		}
+	}
+}
+
+// Close stops the health checks and closes the primary and replica pools.
+func (r *ReplicatedDB) Close() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	r.wg.Wait()
+
+	// Closing through the connections lets them connect again later.
+	errs := []error{r.conn.Close(r.primary)}
+	for _, rep := range r.replicas {
+		rep.mu.Lock()
+		if rep.db != nil {
+			errs = append(errs, rep.conn.Close(rep.db))
+			rep.db, rep.healthy = nil, false
+		}
+		rep.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,462 @@
+package goutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// NotFoundError is returned when no entity matches. It wraps gorm.ErrRecordNotFound.
+type NotFoundError struct {
+	Entity string
+	Key    interface{}
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Key == nil {
+		return fmt.Sprintf("%s not found", e.Entity)
+	}
+	return fmt.Sprintf("%s %v not found", e.Entity, e.Key)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return gorm.ErrRecordNotFound
+}
+
+// IsNotFound reports whether err is a NotFoundError or gorm.ErrRecordNotFound.
+func IsNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// Filter operators accepted by QueryFilter.Op.
+const (
+	OpEq      = "="
+	OpNotEq   = "<>"
+	OpLt      = "<"
+	OpLte     = "<="
+	OpGt      = ">"
+	OpGte     = ">="
+	OpIn      = "IN"
+	OpNotIn   = "NOT IN"
+	OpLike    = "LIKE"
+	OpIsNull  = "IS NULL"
+	OpNotNull = "IS NOT NULL"
+)
+
+// QueryFilter is a condition on a column, named by its column or Go field name.
+// An empty Op means OpEq.
+type QueryFilter struct {
+	Field string
+	Op    string
+	Value interface{}
+}
+
+// ListOptions selects, sorts and pages the entities returned by List.
+type ListOptions struct {
+	Filters []QueryFilter
+	// OrderBy lists fields to sort by, ascending or descending when prefixed by "-".
+	OrderBy []string
+	Limit   int
+	Offset  int
+	// IncludeDeleted includes soft-deleted entities.
+	IncludeDeleted bool
+}
+
+// Repository implements common CRUD operations for the gorm model T. Since gorm
+// v1 has no context support, the context is only checked before each database
+// call: cancelling it or reaching its deadline does not interrupt a query that is
+// already running. Use a statement timeout on the database to bound queries.
+type Repository[T any] struct {
+	db      *gorm.DB
+	entity  string
+	columns map[string]string
+}
+
+func NewRepository[T any](db *gorm.DB) *Repository[T] {
+	var model T
+	return &Repository[T]{db: db, entity: reflect.TypeOf(model).Name(), columns: modelColumns(db, &model)}
+}
+
+// modelColumns maps the column and Go field names of model to its columns.
+func modelColumns(db *gorm.DB, model interface{}) map[string]string {
+	columns := make(map[string]string)
+	for _, field := range db.NewScope(model).GetModelStruct().StructFields {
+		if field.IsIgnored || !field.IsNormal {
+			continue
+		}
+		columns[field.DBName] = field.DBName
+		columns[field.Name] = field.DBName
+	}
+	return columns
+}
+
+// WithDB returns a copy of the repository using db, typically a transaction.
+func (r *Repository[T]) WithDB(db *gorm.DB) *Repository[T] {
+	copied := *r
+	copied.db = db
+	return &copied
+}
+
+// DB returns the database the repository uses.
+func (r *Repository[T]) DB() *gorm.DB {
+	return r.db
+}
+
+func (r *Repository[T]) session(ctx context.Context) (*gorm.DB, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.db, nil
+}
+
+// column resolves a column or Go field name to a column, rejecting anything else
+// since it ends up in SQL.
+func (r *Repository[T]) column(field string) (string, error) {
+	column, ok := r.columns[field]
+	if !ok {
+		return "", fmt.Errorf("%s has no field %q", r.entity, field)
+	}
+	return column, nil
+}
+
+func (r *Repository[T]) primaryKey(db *gorm.DB) string {
+	var model T
+	return db.NewScope(&model).PrimaryKey()
+}
+
+// Get returns the entity with the given primary key.
+func (r *Repository[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+	db, err := r.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var entity T
+	err = db.Where(fmt.Sprintf("%s = ?", db.Dialect().Quote(r.primaryKey(db))), id).First(&entity).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, &NotFoundError{Entity: r.entity, Key: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// List returns the entities matching opts.
+func (r *Repository[T]) List(ctx context.Context, opts ListOptions) ([]T, error) {
+	db, err := r.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts.IncludeDeleted {
+		db = db.Unscoped()
+	}
+	if db, err = r.applyFilters(db, opts.Filters); err != nil {
+		return nil, err
+	}
+	for _, order := range opts.OrderBy {
+		direction := "ASC"
+		if strings.HasPrefix(order, "-") {
+			order, direction = order[1:], "DESC"
+		}
+		column, err := r.column(order)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Order(fmt.Sprintf("%s %s", db.Dialect().Quote(column), direction))
+	}
+	if opts.Limit > 0 {
+		db = db.Limit(opts.Limit)
+	}
+	if opts.Offset > 0 {
+		db = db.Offset(opts.Offset)
+	}
+
+	entities := []T{}
+	if err := db.Find(&entities).Error; err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+func (r *Repository[T]) applyFilters(db *gorm.DB, filters []QueryFilter) (*gorm.DB, error) {
+	for _, filter := range filters {
+		column, err := r.column(filter.Field)
+		if err != nil {
+			return nil, err
+		}
+		quoted := db.Dialect().Quote(column)
+		op := strings.ToUpper(strings.TrimSpace(filter.Op))
+		switch op {
+		case "", OpEq, "==":
+			db = db.Where(quoted+" = ?", filter.Value)
+		case OpNotEq, "!=", OpLt, OpLte, OpGt, OpGte, OpLike:
+			if op == "!=" {
+				op = OpNotEq
+			}
+			db = db.Where(fmt.Sprintf("%s %s ?", quoted, op), filter.Value)
+		case OpIn, OpNotIn:
+			db = db.Where(fmt.Sprintf("%s %s (?)", quoted, op), filter.Value)
+		case OpIsNull, OpNotNull:
+			db = db.Where(fmt.Sprintf("%s %s", quoted, op))
+		default:
+			return nil, fmt.Errorf("unsupported filter operator %q", filter.Op)
+		}
+	}
+	return db, nil
+}
+
+// Create inserts entity and fills its primary key and defaults.
+func (r *Repository[T]) Create(ctx context.Context, entity *T) error {
+	db, err := r.session(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Create(entity).Error
+}
+
+// Update saves entity. When fields are given only those columns are written,
+// zero values included; otherwise all columns are.
+func (r *Repository[T]) Update(ctx context.Context, entity *T, fields ...string) error {
+	db, err := r.session(ctx)
+	if err != nil {
+		return err
+	}
+	scope := db.NewScope(entity)
+	if scope.PrimaryKeyZero() {
+		return fmt.Errorf("updating %s: primary key is not set", r.entity)
+	}
+
+	var result *gorm.DB
+	if len(fields) == 0 {
+		result = db.Model(entity).Updates(r.values(scope, nil), false)
+	} else {
+		columns := make(map[string]bool, len(fields))
+		for _, field := range fields {
+			column, err := r.column(field)
+			if err != nil {
+				return err
+			}
+			columns[column] = true
+		}
+		result = db.Model(entity).Updates(r.values(scope, columns))
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// MySQL reports unchanged rows as not affected.
+		exists, err := r.exists(db, []QueryFilter{{Field: scope.PrimaryKey(), Value: scope.PrimaryKeyValue()}})
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return &NotFoundError{Entity: r.entity, Key: scope.PrimaryKeyValue()}
+		}
+	}
+	return nil
+}
+
+// values returns the column values of the scope, restricted to columns when
+// not nil, excluding primary keys.
+func (r *Repository[T]) values(scope *gorm.Scope, columns map[string]bool) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, field := range scope.Fields() {
+		if !field.IsNormal || field.IsIgnored || field.IsPrimaryKey {
+			continue
+		}
+		if columns != nil && !columns[field.DBName] {
+			continue
+		}
+		values[field.DBName] = field.Field.Interface()
+	}
+	return values
+}
+
+// Delete deletes the entity with the given primary key, softly if T has a
+// DeletedAt field.
+func (r *Repository[T]) Delete(ctx context.Context, id interface{}) error {
+	db, err := r.session(ctx)
+	if err != nil {
+		return err
+	}
+	return r.delete(db, id)
+}
+
+// HardDelete deletes the entity with the given primary key, even if T supports
+// soft deletion.
+func (r *Repository[T]) HardDelete(ctx context.Context, id interface{}) error {
+	db, err := r.session(ctx)
+	if err != nil {
+		return err
+	}
+	return r.delete(db.Unscoped(), id)
+}
+
+func (r *Repository[T]) delete(db *gorm.DB, id interface{}) error {
+	var model T
+	result := db.Where(fmt.Sprintf("%s = ?", db.Dialect().Quote(r.primaryKey(db))), id).Delete(&model)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &NotFoundError{Entity: r.entity, Key: id}
+	}
+	return nil
+}
+
+// Upsert inserts entity or, when it conflicts on conflictFields, updates
+// updateFields. When updateFields is empty all other columns are updated.
+func (r *Repository[T]) Upsert(ctx context.Context, entity *T, conflictFields []string, updateFields ...string) error {
+	db, err := r.session(ctx)
+	if err != nil {
+		return err
+	}
+	scope := db.NewScope(entity)
+	conflict, err := r.resolveColumns(conflictFields)
+	if err != nil {
+		return err
+	}
+	if len(conflict) == 0 {
+		conflict = []string{scope.PrimaryKey()}
+	}
+	update, err := r.resolveColumns(updateFields)
+	if err != nil {
+		return err
+	}
+	if len(update) == 0 {
+		update = upsertUpdateColumns(scope, conflict)
+	}
+
+	clause, err := upsertClause(db.Dialect(), conflict, update)
+	if err != nil {
+		return err
+	}
+	// Postgres returns no row from DO NOTHING.
+	if err := db.Set("gorm:insert_option", clause).Create(entity).Error; err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// The inserted id is unreliable when the row was updated instead, so reload
+	// the stored row by its conflict columns.
+	reload := db
+	for _, column := range conflict {
+		field, ok := scope.FieldByName(column)
+		if !ok {
+			return fmt.Errorf("%s has no field %q", r.entity, column)
+		}
+		reload = reload.Where(fmt.Sprintf("%s = ?", db.Dialect().Quote(column)), field.Field.Interface())
+	}
+	// Reload into a zero value, since First also filters on a set primary key.
+	var stored T
+	if err := reload.First(&stored).Error; err != nil {
+		return err
+	}
+	*entity = stored
+	return nil
+}
+
+func (r *Repository[T]) resolveColumns(fields []string) ([]string, error) {
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		column, err := r.column(field)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// upsertUpdateColumns returns the columns overwritten on conflict by default:
+// all but the primary keys, the conflict columns and created_at.
+func upsertUpdateColumns(scope *gorm.Scope, conflict []string) []string {
+	var columns []string
+	for _, field := range scope.GetModelStruct().StructFields {
+		if !field.IsNormal || field.IsIgnored || field.IsPrimaryKey || field.DBName == "created_at" {
+			continue
+		}
+		if containsFold(conflict, field.DBName) {
+			continue
+		}
+		columns = append(columns, field.DBName)
+	}
+	return columns
+}
+
+// upsertClause returns the insert suffix turning an INSERT into an upsert for
+// the dialect: ON CONFLICT for postgres and sqlite, ON DUPLICATE KEY for mysql.
+func upsertClause(dialect gorm.Dialect, conflict, update []string) (string, error) {
+	quoted := func(columns []string) []string {
+		out := make([]string, len(columns))
+		for i, column := range columns {
+			out[i] = dialect.Quote(column)
+		}
+		return out
+	}
+
+	switch dialect.GetName() {
+	case POSTGRESQL, SQLITE3:
+		target := fmt.Sprintf("ON CONFLICT (%s)", strings.Join(quoted(conflict), ", "))
+		if len(update) == 0 {
+			return target + " DO NOTHING", nil
+		}
+		sets := make([]string, len(update))
+		for i, column := range quoted(update) {
+			sets[i] = fmt.Sprintf("%s = excluded.%s", column, column)
+		}
+		return target + " DO UPDATE SET " + strings.Join(sets, ", "), nil
+	case MYSQL:
+		// MySQL resolves conflicts on any unique key; a self-assignment is a no-op.
+		if len(update) == 0 {
+			update = conflict[:1]
+		}
+		sets := make([]string, len(update))
+		for i, column := range quoted(update) {
+			sets[i] = fmt.Sprintf("%s = VALUES(%s)", column, column)
+		}
+		return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", "), nil
+	default:
+		return "", fmt.Errorf("upsert is not supported for dialect %q", dialect.GetName())
+	}
+}
+
+// Count returns the number of entities matching filters.
+func (r *Repository[T]) Count(ctx context.Context, filters ...QueryFilter) (int64, error) {
+	db, err := r.session(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return r.count(db, filters)
+}
+
+func (r *Repository[T]) count(db *gorm.DB, filters []QueryFilter) (int64, error) {
+	db, err := r.applyFilters(db, filters)
+	if err != nil {
+		return 0, err
+	}
+	var model T
+	var count int64
+	if err := db.Model(&model).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Exists reports whether an entity matches filters.
+func (r *Repository[T]) Exists(ctx context.Context, filters ...QueryFilter) (bool, error) {
+	db, err := r.session(ctx)
+	if err != nil {
+		return false, err
+	}
+	return r.exists(db, filters)
+}
+
+func (r *Repository[T]) exists(db *gorm.DB, filters []QueryFilter) (bool, error) {
+	count, err := r.count(db.Limit(1), filters)
+	return count > 0, err
+}
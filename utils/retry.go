@@ -0,0 +1,40 @@
+package goutils
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// backoff computes exponential delays with full jitter between retries.
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+}
+
+// delay returns the wait before retry number attempt, counting from zero.
+func (b backoff) delay(attempt int) time.Duration {
+	d := b.initial
+	for i := 0; i < attempt && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
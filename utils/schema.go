@@ -0,0 +1,1097 @@
+package goutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// schemaMigrationsTable is where golang-migrate records the applied version. It
+// is left out of inspected schemas.
+const schemaMigrationsTable = "schema_migrations"
+
+// Schema describes the tables of a database, as read by InspectSchema or derived
+// from gorm models by SchemaFromModels.
+type Schema struct {
+	Dialect string
+	Tables  []SchemaTable
+}
+
+type SchemaTable struct {
+	Name        string
+	Columns     []SchemaColumn
+	PrimaryKey  []string
+	Indexes     []SchemaIndex
+	ForeignKeys []SchemaForeignKey
+}
+
+// SchemaColumn describes a column. Type is normalized so that the types declared
+// by gorm and the ones reported by the database compare equal, e.g. "serial"
+// becomes an auto-incremented "integer". Defaults are not compared.
+type SchemaColumn struct {
+	Name          string
+	Type          string
+	Nullable      bool
+	AutoIncrement bool
+}
+
+// SchemaIndex describes an index, including the ones backing unique constraints
+// but not the primary key.
+type SchemaIndex struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// SchemaForeignKey describes a foreign key. Name is empty for SQLite, which does
+// not report it.
+type SchemaForeignKey struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+}
+
+// Table returns the table named name, or nil.
+func (s *Schema) Table(name string) *SchemaTable {
+	for i := range s.Tables {
+		if s.Tables[i].Name == name {
+			return &s.Tables[i]
+		}
+	}
+	return nil
+}
+
+// Column returns the column named name, or nil.
+func (t *SchemaTable) Column(name string) *SchemaColumn {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+func (t *SchemaTable) index(name string) *SchemaIndex {
+	for i := range t.Indexes {
+		if t.Indexes[i].Name == name {
+			return &t.Indexes[i]
+		}
+	}
+	return nil
+}
+
+func (t *SchemaTable) foreignKey(name string) *SchemaForeignKey {
+	for i := range t.ForeignKeys {
+		if t.ForeignKeys[i].Name == name {
+			return &t.ForeignKeys[i]
+		}
+	}
+	return nil
+}
+
+// InspectSchema reads the schema of the database of db, in the current schema for
+// PostgreSQL and the current database for MySQL. To compare against migrations,
+// inspect a scratch database they were applied to, e.g. a TestDB.
+func InspectSchema(ctx context.Context, db *gorm.DB) (*Schema, error) {
+	querier, ok := db.CommonDB().(interface {
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	})
+	if !ok {
+		return nil, errors.New("inspecting schema: the connection does not support contexts")
+	}
+	inspector := &schemaInspector{ctx: ctx, querier: querier, tables: map[string]*SchemaTable{}}
+	dialect := db.Dialect().GetName()
+	var err error
+	switch dialect {
+	case SQLITE3:
+		err = inspector.sqlite()
+	case POSTGRESQL:
+		err = inspector.postgres()
+	case MYSQL:
+		err = inspector.mysql()
+	default:
+		err = fmt.Errorf("schema inspection is not supported for database type %q", dialect)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("inspecting schema: %w", err)
+	}
+
+	schema := &Schema{Dialect: dialect}
+	for _, name := range inspector.names {
+		table := inspector.tables[name]
+		for i := range table.Columns {
+			column := &table.Columns[i]
+			column.Type, _ = normalizeColumnType(dialect, column.Type)
+		}
+		schema.Tables = append(schema.Tables, *table)
+	}
+	sortSchema(schema)
+	return schema, nil
+}
+
+// InspectSchema reads the schema of the connected database. See InspectSchema.
+func (c *DBConn) InspectSchema(ctx context.Context) (*Schema, error) {
+	db := c.DB()
+	if db == nil {
+		return nil, errors.New("inspecting schema: not connected")
+	}
+	return InspectSchema(ctx, db)
+}
+
+type schemaInspector struct {
+	ctx     context.Context
+	querier interface {
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	}
+	names  []string
+	tables map[string]*SchemaTable
+}
+
+// query calls scan for each row of query.
+func (i *schemaInspector) query(query string, scan func(rows *sql.Rows) error, args ...interface{}) error {
+	rows, err := i.querier.QueryContext(i.ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (i *schemaInspector) addTable(name string) {
+	if name == schemaMigrationsTable {
+		return
+	}
+	i.names = append(i.names, name)
+	i.tables[name] = &SchemaTable{Name: name}
+}
+
+// addIndexColumn appends column to the index name of table, creating the index
+// on its first column. Primary key columns go to the primary key.
+func (i *schemaInspector) addIndexColumn(table, name, column string, unique, primary bool) {
+	t := i.tables[table]
+	if t == nil {
+		return
+	}
+	if primary {
+		t.PrimaryKey = append(t.PrimaryKey, column)
+		return
+	}
+	index := t.index(name)
+	if index == nil {
+		t.Indexes = append(t.Indexes, SchemaIndex{Name: name, Unique: unique})
+		index = &t.Indexes[len(t.Indexes)-1]
+	}
+	index.Columns = append(index.Columns, column)
+}
+
+func (i *schemaInspector) addForeignKeyColumn(table, name, column, refTable, refColumn string) {
+	t := i.tables[table]
+	if t == nil {
+		return
+	}
+	fk := t.foreignKey(name)
+	if fk == nil {
+		t.ForeignKeys = append(t.ForeignKeys, SchemaForeignKey{Name: name, RefTable: refTable})
+		fk = &t.ForeignKeys[len(t.ForeignKeys)-1]
+	}
+	fk.Columns = append(fk.Columns, column)
+	fk.RefColumns = append(fk.RefColumns, refColumn)
+}
+
+func (i *schemaInspector) sqlite() error {
+	err := i.query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name", func(rows *sql.Rows) error {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		i.addTable(name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range i.names {
+		table := i.tables[name]
+		quoted := quoteIdentifier(SQLITE3, name)
+		type pk struct {
+			position int
+			column   string
+		}
+		var pks []pk
+		err := i.query("PRAGMA table_info("+quoted+")", func(rows *sql.Rows) error {
+			var cid, notNull, position int
+			var column, typ string
+			var defaultValue sql.NullString
+			if err := rows.Scan(&cid, &column, &typ, &notNull, &defaultValue, &position); err != nil {
+				return err
+			}
+			table.Columns = append(table.Columns, SchemaColumn{Name: column, Type: typ, Nullable: notNull == 0 && position == 0})
+			if position > 0 {
+				pks = append(pks, pk{position, column})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.Slice(pks, func(a, b int) bool { return pks[a].position < pks[b].position })
+		for _, pk := range pks {
+			table.PrimaryKey = append(table.PrimaryKey, pk.column)
+		}
+		if len(pks) == 1 {
+			// An INTEGER PRIMARY KEY is an alias of the auto-assigned rowid.
+			if column := table.Column(pks[0].column); strings.EqualFold(column.Type, "integer") {
+				column.AutoIncrement = true
+			}
+		}
+
+		var indexes []SchemaIndex
+		err = i.query("PRAGMA index_list("+quoted+")", func(rows *sql.Rows) error {
+			var seq, unique, partial int
+			var index, origin string
+			if err := rows.Scan(&seq, &index, &unique, &origin, &partial); err != nil {
+				return err
+			}
+			if origin != "pk" {
+				indexes = append(indexes, SchemaIndex{Name: index, Unique: unique == 1})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, index := range indexes {
+			err := i.query("PRAGMA index_info("+quoteIdentifier(SQLITE3, index.Name)+")", func(rows *sql.Rows) error {
+				var seq, cid int
+				var column sql.NullString
+				if err := rows.Scan(&seq, &cid, &column); err != nil {
+					return err
+				}
+				index.Columns = append(index.Columns, column.String)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			table.Indexes = append(table.Indexes, index)
+		}
+
+		var fks []SchemaForeignKey
+		err = i.query("PRAGMA foreign_key_list("+quoted+")", func(rows *sql.Rows) error {
+			var id, seq int
+			var refTable, from string
+			var to sql.NullString
+			var onUpdate, onDelete, match string
+			if err := rows.Scan(&id, &seq, &refTable, &from, &to, &onUpdate, &onDelete, &match); err != nil {
+				return err
+			}
+			if seq == 0 {
+				fks = append(fks, SchemaForeignKey{RefTable: refTable})
+			}
+			fk := &fks[len(fks)-1]
+			fk.Columns = append(fk.Columns, from)
+			fk.RefColumns = append(fk.RefColumns, to.String)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		table.ForeignKeys = fks
+	}
+	return nil
+}
+
+func (i *schemaInspector) postgres() error {
+	err := i.query("SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name", func(rows *sql.Rows) error {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		i.addTable(name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = i.query(`SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+		COALESCE(pg_get_expr(d.adbin, d.adrelid) LIKE 'nextval(%', false) OR a.attidentity <> ''
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE n.nspname = current_schema() AND c.relkind = 'r' AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY c.relname, a.attnum`, func(rows *sql.Rows) error {
+		var table string
+		var column SchemaColumn
+		var notNull bool
+		if err := rows.Scan(&table, &column.Name, &column.Type, &notNull, &column.AutoIncrement); err != nil {
+			return err
+		}
+		column.Nullable = !notNull
+		if t := i.tables[table]; t != nil {
+			t.Columns = append(t.Columns, column)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = i.query(`SELECT t.relname, ic.relname, ix.indisunique, ix.indisprimary, a.attname
+		FROM pg_index ix
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_class ic ON ic.oid = ix.indexrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname = current_schema() AND t.relkind = 'r'
+		ORDER BY t.relname, ic.relname, k.ord`, func(rows *sql.Rows) error {
+		var table, index, column string
+		var unique, primary bool
+		if err := rows.Scan(&table, &index, &unique, &primary, &column); err != nil {
+			return err
+		}
+		i.addIndexColumn(table, index, column, unique, primary)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return i.query(`SELECT t.relname, con.conname, a.attname, rt.relname, ra.attname
+		FROM pg_constraint con
+		JOIN pg_class t ON t.oid = con.conrelid
+		JOIN pg_class rt ON rt.oid = con.confrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, refattnum, ord) ON true
+		JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+		JOIN pg_attribute ra ON ra.attrelid = con.confrelid AND ra.attnum = k.refattnum
+		WHERE con.contype = 'f' AND n.nspname = current_schema()
+		ORDER BY t.relname, con.conname, k.ord`, func(rows *sql.Rows) error {
+		var table, name, column, refTable, refColumn string
+		if err := rows.Scan(&table, &name, &column, &refTable, &refColumn); err != nil {
+			return err
+		}
+		i.addForeignKeyColumn(table, name, column, refTable, refColumn)
+		return nil
+	})
+}
+
+func (i *schemaInspector) mysql() error {
+	err := i.query("SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME", func(rows *sql.Rows) error {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		i.addTable(name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = i.query(`SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, EXTRA FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() ORDER BY TABLE_NAME, ORDINAL_POSITION`, func(rows *sql.Rows) error {
+		var table, nullable, extra string
+		var column SchemaColumn
+		if err := rows.Scan(&table, &column.Name, &column.Type, &nullable, &extra); err != nil {
+			return err
+		}
+		column.Nullable = nullable == "YES"
+		column.AutoIncrement = strings.Contains(strings.ToLower(extra), "auto_increment")
+		if t := i.tables[table]; t != nil {
+			t.Columns = append(t.Columns, column)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = i.query(`SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`, func(rows *sql.Rows) error {
+		var table, index, column string
+		var nonUnique int
+		if err := rows.Scan(&table, &index, &nonUnique, &column); err != nil {
+			return err
+		}
+		i.addIndexColumn(table, index, column, nonUnique == 0, index == "PRIMARY")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return i.query(`SELECT TABLE_NAME, CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION`, func(rows *sql.Rows) error {
+		var table, name, column, refTable, refColumn string
+		if err := rows.Scan(&table, &name, &column, &refTable, &refColumn); err != nil {
+			return err
+		}
+		i.addForeignKeyColumn(table, name, column, refTable, refColumn)
+		return nil
+	})
+}
+
+// SchemaFromModels derives the schema that AutoMigrate creates for models in the
+// dialect of db, without touching the database. Models declare no foreign keys.
+func SchemaFromModels(db *gorm.DB, models ...interface{}) (schema *Schema, err error) {
+	defer func() {
+		// DataTypeOf panics on fields of unsupported types.
+		if r := recover(); r != nil {
+			schema, err = nil, fmt.Errorf("deriving schema from models: %v", r)
+		}
+	}()
+
+	dialect := db.Dialect()
+	schema = &Schema{Dialect: dialect.GetName()}
+	for _, model := range models {
+		scope := db.NewScope(model)
+		table := SchemaTable{Name: scope.TableName()}
+		indexes := map[string]*SchemaIndex{}
+		addIndex := func(name, column string, unique bool) {
+			name, column = dialect.NormalizeIndexAndColumn(name, column)
+			if indexes[name] == nil {
+				indexes[name] = &SchemaIndex{Name: name, Unique: unique}
+			}
+			indexes[name].Columns = append(indexes[name].Columns, column)
+		}
+
+		for _, field := range scope.GetModelStruct().StructFields {
+			if !field.IsNormal {
+				continue
+			}
+			typ, autoIncrement := normalizeColumnType(schema.Dialect, dialect.DataTypeOf(field))
+			_, notNull := field.TagSettingsGet("NOT NULL")
+			table.Columns = append(table.Columns, SchemaColumn{
+				Name:          field.DBName,
+				Type:          typ,
+				Nullable:      !notNull && !field.IsPrimaryKey,
+				AutoIncrement: autoIncrement,
+			})
+			if field.IsPrimaryKey {
+				table.PrimaryKey = append(table.PrimaryKey, field.DBName)
+			}
+			if _, ok := field.TagSettingsGet("UNIQUE"); ok {
+				addIndex(dialect.BuildKeyName("uix", table.Name, field.DBName), field.DBName, true)
+			}
+			for _, setting := range []struct {
+				key, kind string
+				unique    bool
+			}{{"INDEX", "idx", false}, {"UNIQUE_INDEX", "uix", true}} {
+				names, ok := field.TagSettingsGet(setting.key)
+				if !ok {
+					continue
+				}
+				for _, name := range strings.Split(names, ",") {
+					if name == setting.key || name == "" {
+						name = dialect.BuildKeyName(setting.kind, table.Name, field.DBName)
+					}
+					addIndex(name, field.DBName, setting.unique)
+				}
+			}
+		}
+		for _, index := range indexes {
+			table.Indexes = append(table.Indexes, *index)
+		}
+		schema.Tables = append(schema.Tables, table)
+	}
+	sortSchema(schema)
+	return schema, nil
+}
+
+func sortSchema(schema *Schema) {
+	sort.Slice(schema.Tables, func(a, b int) bool { return schema.Tables[a].Name < schema.Tables[b].Name })
+	for _, table := range schema.Tables {
+		sort.Slice(table.Indexes, func(a, b int) bool { return table.Indexes[a].Name < table.Indexes[b].Name })
+		sort.Slice(table.ForeignKeys, func(a, b int) bool { return table.ForeignKeys[a].Name < table.ForeignKeys[b].Name })
+	}
+}
+
+var (
+	columnModifiers  = []string{"primary key", "autoincrement", "auto_increment", "not null", "unique", "null"}
+	mysqlIntWidth    = regexp.MustCompile(`\b(tinyint|smallint|mediumint|int|bigint)\(\d+\)`)
+	postgresSerials  = map[string]string{"smallserial": "smallint", "serial": "integer", "bigserial": "bigint"}
+	postgresAliases  = map[string]string{"int": "integer", "int4": "integer", "int2": "smallint", "int8": "bigint", "bool": "boolean", "float8": "double precision", "float4": "real", "decimal": "numeric", "timestamptz": "timestamp with time zone", "timestamp": "timestamp without time zone"}
+	postgresPrefixes = [][2]string{{"varchar(", "character varying("}, {"char(", "character("}, {"decimal(", "numeric("}}
+)
+
+// normalizeColumnType strips the constraints gorm appends to column types and maps
+// the aliases of dialect to the names its catalog reports, returning whether the
+// type was auto-incremented.
+func normalizeColumnType(dialect, typ string) (string, bool) {
+	t := " " + strings.ToLower(strings.TrimSpace(typ)) + " "
+	for _, clause := range []string{" default ", " comment "} {
+		if i := strings.Index(t, clause); i >= 0 {
+			t = t[:i+1]
+		}
+	}
+	autoIncrement := false
+	for _, modifier := range columnModifiers {
+		if strings.Contains(t, " "+modifier+" ") {
+			t = strings.ReplaceAll(t, " "+modifier+" ", " ")
+			autoIncrement = autoIncrement || strings.HasPrefix(modifier, "auto")
+		}
+	}
+	t = strings.Join(strings.Fields(t), " ")
+
+	switch dialect {
+	case POSTGRESQL:
+		if base, ok := postgresSerials[t]; ok {
+			t, autoIncrement = base, true
+		}
+		if alias, ok := postgresAliases[t]; ok {
+			t = alias
+		}
+		for _, prefix := range postgresPrefixes {
+			if strings.HasPrefix(t, prefix[0]) {
+				t = prefix[1] + strings.TrimPrefix(t, prefix[0])
+			}
+		}
+	case MYSQL:
+		if t == "boolean" || t == "bool" {
+			t = "tinyint(1)"
+		}
+		if t == "integer" || strings.HasPrefix(t, "integer ") {
+			t = "int" + strings.TrimPrefix(t, "integer")
+		}
+		t = mysqlIntWidth.ReplaceAllStringFunc(t, func(s string) string {
+			if s == "tinyint(1)" {
+				return s
+			}
+			return s[:strings.Index(s, "(")]
+		})
+	}
+	return t, autoIncrement
+}
+
+// SchemaChangeKind is the kind of a SchemaChange.
+type SchemaChangeKind string
+
+const (
+	SchemaAddTable        SchemaChangeKind = "add table"
+	SchemaDropTable       SchemaChangeKind = "drop table"
+	SchemaAddColumn       SchemaChangeKind = "add column"
+	SchemaDropColumn      SchemaChangeKind = "drop column"
+	SchemaAlterColumn     SchemaChangeKind = "alter column"
+	SchemaAlterPrimaryKey SchemaChangeKind = "alter primary key"
+	SchemaAddIndex        SchemaChangeKind = "add index"
+	SchemaDropIndex       SchemaChangeKind = "drop index"
+	SchemaAddForeignKey   SchemaChangeKind = "add foreign key"
+	SchemaDropForeignKey  SchemaChangeKind = "drop foreign key"
+)
+
+// schemaChangeOrder is the order in which SQL applies the changes, so that
+// dropped foreign keys and indexes no longer hold on to what is changed next.
+var schemaChangeOrder = map[SchemaChangeKind]int{
+	SchemaDropForeignKey:  0,
+	SchemaDropIndex:       1,
+	SchemaAddTable:        2,
+	SchemaAddColumn:       3,
+	SchemaAlterColumn:     4,
+	SchemaAlterPrimaryKey: 5,
+	SchemaDropColumn:      6,
+	SchemaAddIndex:        7,
+	SchemaAddForeignKey:   8,
+	SchemaDropTable:       9,
+}
+
+// SchemaChange is a difference that turns the actual schema into the expected one.
+type SchemaChange struct {
+	Kind  SchemaChangeKind
+	Table string
+	// Name is the column, index or foreign key, empty for tables and primary keys.
+	Name string
+	// Expected and Actual describe the definitions in each schema, e.g. a column
+	// type, and are empty where it is missing.
+	Expected string
+	Actual   string
+}
+
+func (c SchemaChange) String() string {
+	target := c.Table
+	if c.Name != "" {
+		target += "." + c.Name
+	}
+	switch {
+	case c.Expected != "" && c.Actual != "":
+		return fmt.Sprintf("%s %s: %s, expected %s", c.Kind, target, c.Actual, c.Expected)
+	case c.Expected != "":
+		return fmt.Sprintf("%s %s %s", c.Kind, target, c.Expected)
+	case c.Actual != "":
+		return fmt.Sprintf("%s %s %s", c.Kind, target, c.Actual)
+	}
+	return fmt.Sprintf("%s %s", c.Kind, target)
+}
+
+// SchemaDiff lists the changes from an actual schema to an expected one.
+type SchemaDiff struct {
+	Changes  []SchemaChange
+	expected *Schema
+	actual   *Schema
+}
+
+// Empty reports whether the schemas match.
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+func (d *SchemaDiff) String() string {
+	lines := make([]string, len(d.Changes))
+	for i, change := range d.Changes {
+		lines[i] = change.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DiffSchemas compares the actual schema, typically the live database, with the
+// expected one. Indexes and foreign keys are matched by definition rather than
+// by name, as databases name those of constraints themselves.
+func DiffSchemas(expected, actual *Schema) *SchemaDiff {
+	diff := &SchemaDiff{expected: expected, actual: actual}
+	for _, table := range expected.Tables {
+		if actual.Table(table.Name) == nil {
+			diff.Changes = append(diff.Changes, SchemaChange{Kind: SchemaAddTable, Table: table.Name})
+		}
+	}
+	for _, actualTable := range actual.Tables {
+		expectedTable := expected.Table(actualTable.Name)
+		if expectedTable == nil {
+			diff.Changes = append(diff.Changes, SchemaChange{Kind: SchemaDropTable, Table: actualTable.Name})
+			continue
+		}
+		diff.Changes = append(diff.Changes, diffTables(expectedTable, &actualTable)...)
+	}
+	return diff
+}
+
+func diffTables(expected, actual *SchemaTable) []SchemaChange {
+	var changes []SchemaChange
+	table := actual.Name
+	change := func(kind SchemaChangeKind, name, e, a string) {
+		changes = append(changes, SchemaChange{Kind: kind, Table: table, Name: name, Expected: e, Actual: a})
+	}
+
+	for _, column := range expected.Columns {
+		current := actual.Column(column.Name)
+		if current == nil {
+			change(SchemaAddColumn, column.Name, describeColumn(column), "")
+		} else if *current != column {
+			change(SchemaAlterColumn, column.Name, describeColumn(column), describeColumn(*current))
+		}
+	}
+	for _, column := range actual.Columns {
+		if expected.Column(column.Name) == nil {
+			change(SchemaDropColumn, column.Name, "", describeColumn(column))
+		}
+	}
+	if strings.Join(expected.PrimaryKey, ",") != strings.Join(actual.PrimaryKey, ",") {
+		change(SchemaAlterPrimaryKey, "", describeColumns(expected.PrimaryKey), describeColumns(actual.PrimaryKey))
+	}
+
+	actualIndexes := map[string]bool{}
+	for _, index := range actual.Indexes {
+		actualIndexes[describeIndex(index)] = true
+	}
+	expectedIndexes := map[string]bool{}
+	for _, index := range expected.Indexes {
+		expectedIndexes[describeIndex(index)] = true
+		if !actualIndexes[describeIndex(index)] {
+			change(SchemaAddIndex, index.Name, describeIndex(index), "")
+		}
+	}
+	for _, index := range actual.Indexes {
+		if !expectedIndexes[describeIndex(index)] {
+			change(SchemaDropIndex, index.Name, "", describeIndex(index))
+		}
+	}
+
+	actualFKs := map[string]bool{}
+	for _, fk := range actual.ForeignKeys {
+		actualFKs[describeForeignKey(fk)] = true
+	}
+	expectedFKs := map[string]bool{}
+	for _, fk := range expected.ForeignKeys {
+		expectedFKs[describeForeignKey(fk)] = true
+		if !actualFKs[describeForeignKey(fk)] {
+			change(SchemaAddForeignKey, fk.Name, describeForeignKey(fk), "")
+		}
+	}
+	for _, fk := range actual.ForeignKeys {
+		if !expectedFKs[describeForeignKey(fk)] {
+			change(SchemaDropForeignKey, fk.Name, "", describeForeignKey(fk))
+		}
+	}
+	return changes
+}
+
+func describeColumn(column SchemaColumn) string {
+	description := column.Type
+	if !column.Nullable {
+		description += " not null"
+	}
+	if column.AutoIncrement {
+		description += " auto increment"
+	}
+	return description
+}
+
+func describeColumns(columns []string) string {
+	return "(" + strings.Join(columns, ", ") + ")"
+}
+
+func describeIndex(index SchemaIndex) string {
+	if index.Unique {
+		return "unique " + describeColumns(index.Columns)
+	}
+	return describeColumns(index.Columns)
+}
+
+func describeForeignKey(fk SchemaForeignKey) string {
+	return describeColumns(fk.Columns) + " references " + fk.RefTable + " " + describeColumns(fk.RefColumns)
+}
+
+// SQL returns the statements applying the changes to the actual schema, in its
+// dialect, and the statements reverting them. Changes that the dialect cannot
+// make in place, such as altering SQLite columns or any primary key, are errors
+// and must be migrated by hand.
+func (d *SchemaDiff) SQL() (up, down []string, err error) {
+	changes := append([]SchemaChange(nil), d.Changes...)
+	sort.SliceStable(changes, func(a, b int) bool {
+		return schemaChangeOrder[changes[a].Kind] < schemaChangeOrder[changes[b].Kind]
+	})
+	var reverts [][]string
+	for _, change := range changes {
+		changeUp, changeDown, err := d.changeSQL(d.actual.Dialect, change)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating SQL for %s: %w", change, err)
+		}
+		up = append(up, changeUp...)
+		reverts = append(reverts, changeDown)
+	}
+	for i := len(reverts) - 1; i >= 0; i-- {
+		down = append(down, reverts[i]...)
+	}
+	return up, down, nil
+}
+
+func (d *SchemaDiff) changeSQL(dialect string, change SchemaChange) ([]string, []string, error) {
+	expected, actual := d.expected.Table(change.Table), d.actual.Table(change.Table)
+	switch change.Kind {
+	case SchemaAddTable:
+		return createTableSQL(dialect, expected), []string{dropTableSQL(dialect, expected.Name)}, nil
+	case SchemaDropTable:
+		return []string{dropTableSQL(dialect, actual.Name)}, createTableSQL(dialect, actual), nil
+	case SchemaAddColumn:
+		column := *expected.Column(change.Name)
+		return []string{addColumnSQL(dialect, expected, column)}, []string{dropColumnSQL(dialect, expected.Name, column.Name)}, nil
+	case SchemaDropColumn:
+		column := *actual.Column(change.Name)
+		return []string{dropColumnSQL(dialect, actual.Name, column.Name)}, []string{addColumnSQL(dialect, actual, column)}, nil
+	case SchemaAlterColumn:
+		from, to := *actual.Column(change.Name), *expected.Column(change.Name)
+		up, err := alterColumnSQL(dialect, expected, from, to)
+		if err != nil {
+			return nil, nil, err
+		}
+		down, err := alterColumnSQL(dialect, actual, to, from)
+		return up, down, err
+	case SchemaAddIndex:
+		index := findIndex(expected, change.Expected)
+		return []string{createIndexSQL(dialect, expected.Name, index)}, []string{dropIndexSQL(dialect, expected.Name, index)}, nil
+	case SchemaDropIndex:
+		index := findIndex(actual, change.Actual)
+		return []string{dropIndexSQL(dialect, actual.Name, index)}, []string{createIndexSQL(dialect, actual.Name, index)}, nil
+	case SchemaAddForeignKey, SchemaDropForeignKey:
+		if dialect == SQLITE3 {
+			return nil, nil, errors.New("SQLite cannot change the foreign keys of a table, rebuild it instead")
+		}
+		if change.Kind == SchemaAddForeignKey {
+			fk := findForeignKey(expected, change.Expected)
+			return []string{addForeignKeySQL(dialect, expected.Name, fk)}, []string{dropForeignKeySQL(dialect, expected.Name, fk)}, nil
+		}
+		fk := findForeignKey(actual, change.Actual)
+		return []string{dropForeignKeySQL(dialect, actual.Name, fk)}, []string{addForeignKeySQL(dialect, actual.Name, fk)}, nil
+	}
+	return nil, nil, fmt.Errorf("%s is not supported", change.Kind)
+}
+
+func findIndex(table *SchemaTable, description string) SchemaIndex {
+	for _, index := range table.Indexes {
+		if describeIndex(index) == description {
+			return index
+		}
+	}
+	return SchemaIndex{}
+}
+
+func findForeignKey(table *SchemaTable, description string) SchemaForeignKey {
+	for _, fk := range table.ForeignKeys {
+		if describeForeignKey(fk) == description {
+			return fk
+		}
+	}
+	return SchemaForeignKey{}
+}
+
+func quoteIdentifier(dialect, name string) string {
+	if dialect == MYSQL {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdentifiers(dialect string, names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(dialect, name)
+	}
+	return "(" + strings.Join(quoted, ", ") + ")"
+}
+
+// sqliteRowID reports whether column is the auto-incremented primary key of a
+// SQLite table, which must be declared inline.
+func sqliteRowID(dialect string, table *SchemaTable, column SchemaColumn) bool {
+	return dialect == SQLITE3 && column.AutoIncrement && len(table.PrimaryKey) == 1 && table.PrimaryKey[0] == column.Name
+}
+
+func columnDefinition(dialect string, table *SchemaTable, column SchemaColumn) string {
+	if sqliteRowID(dialect, table, column) {
+		return "integer PRIMARY KEY AUTOINCREMENT"
+	}
+	definition := column.Type
+	if column.AutoIncrement && dialect == POSTGRESQL {
+		for serial, base := range postgresSerials {
+			if base == definition {
+				definition = serial
+			}
+		}
+	}
+	if !column.Nullable {
+		definition += " NOT NULL"
+	}
+	if column.AutoIncrement && dialect == MYSQL {
+		definition += " AUTO_INCREMENT"
+	}
+	return definition
+}
+
+func createTableSQL(dialect string, table *SchemaTable) []string {
+	var definitions []string
+	inlinePrimaryKey := false
+	for _, column := range table.Columns {
+		inlinePrimaryKey = inlinePrimaryKey || sqliteRowID(dialect, table, column)
+		definitions = append(definitions, quoteIdentifier(dialect, column.Name)+" "+columnDefinition(dialect, table, column))
+	}
+	if len(table.PrimaryKey) > 0 && !inlinePrimaryKey {
+		definitions = append(definitions, "PRIMARY KEY "+quoteIdentifiers(dialect, table.PrimaryKey))
+	}
+	for _, fk := range table.ForeignKeys {
+		definition := foreignKeyDefinition(dialect, fk)
+		if fk.Name != "" {
+			definition = "CONSTRAINT " + quoteIdentifier(dialect, fk.Name) + " " + definition
+		}
+		definitions = append(definitions, definition)
+	}
+
+	statements := []string{fmt.Sprintf("CREATE TABLE %s (\n\t%s\n)", quoteIdentifier(dialect, table.Name), strings.Join(definitions, ",\n\t"))}
+	for _, index := range table.Indexes {
+		statements = append(statements, createIndexSQL(dialect, table.Name, index))
+	}
+	return statements
+}
+
+func dropTableSQL(dialect, table string) string {
+	return "DROP TABLE " + quoteIdentifier(dialect, table)
+}
+
+func addColumnSQL(dialect string, table *SchemaTable, column SchemaColumn) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quoteIdentifier(dialect, table.Name),
+		quoteIdentifier(dialect, column.Name), columnDefinition(dialect, table, column))
+}
+
+func dropColumnSQL(dialect, table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", quoteIdentifier(dialect, table), quoteIdentifier(dialect, column))
+}
+
+func alterColumnSQL(dialect string, table *SchemaTable, from, to SchemaColumn) ([]string, error) {
+	prefix := fmt.Sprintf("ALTER TABLE %s ", quoteIdentifier(dialect, table.Name))
+	column := quoteIdentifier(dialect, to.Name)
+	switch dialect {
+	case MYSQL:
+		return []string{prefix + "MODIFY COLUMN " + column + " " + columnDefinition(dialect, table, to)}, nil
+	case POSTGRESQL:
+		if from.AutoIncrement != to.AutoIncrement {
+			return nil, errors.New("changing whether a column is auto-incremented is not supported")
+		}
+		var statements []string
+		if from.Type != to.Type {
+			statements = append(statements, prefix+"ALTER COLUMN "+column+" TYPE "+to.Type)
+		}
+		if from.Nullable && !to.Nullable {
+			statements = append(statements, prefix+"ALTER COLUMN "+column+" SET NOT NULL")
+		} else if !from.Nullable && to.Nullable {
+			statements = append(statements, prefix+"ALTER COLUMN "+column+" DROP NOT NULL")
+		}
+		return statements, nil
+	}
+	return nil, fmt.Errorf("%s cannot alter columns, rebuild the table instead", dialect)
+}
+
+func indexName(table string, index SchemaIndex) string {
+	if index.Name != "" {
+		return index.Name
+	}
+	kind := "idx"
+	if index.Unique {
+		kind = "uix"
+	}
+	return fmt.Sprintf("%s_%s_%s", kind, table, strings.Join(index.Columns, "_"))
+}
+
+func createIndexSQL(dialect, table string, index SchemaIndex) string {
+	create := "CREATE INDEX"
+	if index.Unique {
+		create = "CREATE UNIQUE INDEX"
+	}
+	return fmt.Sprintf("%s %s ON %s %s", create, quoteIdentifier(dialect, indexName(table, index)),
+		quoteIdentifier(dialect, table), quoteIdentifiers(dialect, index.Columns))
+}
+
+func dropIndexSQL(dialect, table string, index SchemaIndex) string {
+	drop := "DROP INDEX " + quoteIdentifier(dialect, indexName(table, index))
+	if dialect == MYSQL {
+		drop += " ON " + quoteIdentifier(dialect, table)
+	}
+	return drop
+}
+
+func foreignKeyName(table string, fk SchemaForeignKey) string {
+	if fk.Name != "" {
+		return fk.Name
+	}
+	return fmt.Sprintf("fk_%s_%s", table, strings.Join(fk.Columns, "_"))
+}
+
+func foreignKeyDefinition(dialect string, fk SchemaForeignKey) string {
+	return fmt.Sprintf("FOREIGN KEY %s REFERENCES %s %s", quoteIdentifiers(dialect, fk.Columns),
+		quoteIdentifier(dialect, fk.RefTable), quoteIdentifiers(dialect, fk.RefColumns))
+}
+
+func addForeignKeySQL(dialect, table string, fk SchemaForeignKey) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", quoteIdentifier(dialect, table),
+		quoteIdentifier(dialect, foreignKeyName(table, fk)), foreignKeyDefinition(dialect, fk))
+}
+
+func dropForeignKeySQL(dialect, table string, fk SchemaForeignKey) string {
+	drop := "DROP CONSTRAINT"
+	if dialect == MYSQL {
+		drop = "DROP FOREIGN KEY"
+	}
+	return fmt.Sprintf("ALTER TABLE %s %s %s", quoteIdentifier(dialect, table), drop, quoteIdentifier(dialect, foreignKeyName(table, fk)))
+}
+
+// WriteMigrationFiles writes the SQL of the changes to new up and down migration
+// files in dir, named as by CreateMigrationFiles, and returns their paths.
+func (d *SchemaDiff) WriteMigrationFiles(dir, name string, now time.Time) (string, string, error) {
+	if d.Empty() {
+		return "", "", errors.New("writing migration files: the schemas match")
+	}
+	up, down, err := d.SQL()
+	if err != nil {
+		return "", "", err
+	}
+	upPath, downPath, err := CreateMigrationFiles(dir, name, now)
+	if err != nil {
+		return "", "", err
+	}
+	for _, file := range []struct {
+		path       string
+		statements []string
+	}{{upPath, up}, {downPath, down}} {
+		if err := os.WriteFile(file.path, []byte(strings.Join(file.statements, ";\n\n")+";\n"), 0o644); err != nil {
+			os.Remove(upPath)
+			os.Remove(downPath)
+			return "", "", fmt.Errorf("writing migration file: %w", err)
+		}
+	}
+	return upPath, downPath, nil
+}
+
+// CheckSchema compares the schema of the connected database with the one
+// AutoMigrate creates for models and logs a warning for each difference, as
+// AutoMigrate only adds what is missing. Tables without a model are left out,
+// and so are foreign keys, which models do not declare, along with the indexes
+// MySQL creates for them.
+func (c *DBConn) CheckSchema(ctx context.Context, models ...interface{}) (*SchemaDiff, error) {
+	db := c.DB()
+	if db == nil {
+		return nil, errors.New("checking schema: not connected")
+	}
+	expected, err := SchemaFromModels(db, models...)
+	if err != nil {
+		c.logger.Errorf("checking schema: %v", err)
+		return nil, err
+	}
+	live, err := InspectSchema(ctx, db)
+	if err != nil {
+		c.logger.Errorf("checking schema: %v", err)
+		return nil, err
+	}
+	actual := &Schema{Dialect: live.Dialect}
+	for _, table := range expected.Tables {
+		if t := live.Table(table.Name); t != nil {
+			if live.Dialect == MYSQL {
+				t.Indexes = withoutForeignKeyIndexes(t, &table)
+			}
+			t.ForeignKeys = nil
+			actual.Tables = append(actual.Tables, *t)
+		}
+	}
+
+	diff := DiffSchemas(expected, actual)
+	for _, change := range diff.Changes {
+		c.logger.WithField("table", change.Table).Warnf("schema drift: %s", change)
+	}
+	return diff, nil
+}
+
+// withoutForeignKeyIndexes returns the indexes of table but those MySQL created
+// for its foreign keys, which are named after them, unless expected declares them.
+func withoutForeignKeyIndexes(table, expected *SchemaTable) []SchemaIndex {
+	var indexes []SchemaIndex
+	for _, index := range table.Indexes {
+		if index.Unique || expected.index(index.Name) != nil || !backsForeignKey(table, index) {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+func backsForeignKey(table *SchemaTable, index SchemaIndex) bool {
+	for _, fk := range table.ForeignKeys {
+		if fk.Name == index.Name && slices.Equal(fk.Columns, index.Columns) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+// Package sqlite registers the sqlite3 database driver and its migrations with
+// goutils. It requires cgo, so it is kept out of the goutils package; import it
+// for its side effects where SQLite is used:
+//
+//	import _ "github.com/RamanPndy/go-utils/utils/sqlite"
+package sqlite
+
+import (
+	"database/sql"
+
+	goutils "github.com/RamanPndy/go-utils/utils"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+func init() {
+	goutils.RegisterMigrationDriver(goutils.SQLITE3, func(db *sql.DB) (database.Driver, error) {
+		return sqlite3.WithInstance(db, &sqlite3.Config{})
+	})
+}
@@ -0,0 +1,173 @@
+package goutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// TxOptions configures WithTransaction. A nil *TxOptions uses the defaults.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxRetries is the number of times the transaction is retried after a
+	// retryable error. Defaults to 3; a negative value disables retries.
+	MaxRetries int
+	// InitialBackoff and MaxBackoff bound the jittered exponential delay between
+	// retries. They default to 10ms and 1s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// RetryIf reports whether a failed attempt should be retried. Defaults to
+	// IsRetryableTxError.
+	RetryIf func(error) bool
+}
+
+func (o *TxOptions) withDefaults() TxOptions {
+	var opts TxOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = 10 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Second
+	}
+	if opts.RetryIf == nil {
+		opts.RetryIf = IsRetryableTxError
+	}
+	return opts
+}
+
+// IsRetryableTxError reports whether err is a serialization failure or a deadlock
+// after which the whole transaction can safely be run again.
+func IsRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// serialization_failure, deadlock_detected
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+	}
+	return false
+}
+
+// TxPanicError wraps a value recovered from a panic in a transaction function
+// when the rollback that followed also failed.
+type TxPanicError struct {
+	Value         interface{}
+	RollbackError error
+}
+
+func (e *TxPanicError) Error() string {
+	return fmt.Sprintf("transaction panicked: %v (rollback failed: %v)", e.Value, e.RollbackError)
+}
+
+var savepointID uint64
+
+// WithTransaction runs fn in a transaction, committing if it returns nil and
+// rolling back if it returns an error or panics; panics are re-raised after the
+// rollback. The whole transaction is retried with backoff on serialization
+// failures and deadlocks.
+//
+// When db is already a transaction, fn runs inside a savepoint instead so that
+// its failure only undoes its own work. Isolation, ReadOnly and retries are
+// then left to the outermost transaction.
+func WithTransaction(ctx context.Context, db *gorm.DB, opts *TxOptions, fn func(tx *gorm.DB) error) error {
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return withSavepoint(db, fn)
+	}
+
+	o := opts.withDefaults()
+	b := backoff{initial: o.InitialBackoff, max: o.MaxBackoff}
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := runTransaction(ctx, db, &sql.TxOptions{Isolation: o.Isolation, ReadOnly: o.ReadOnly}, fn)
+		if err == nil || attempt >= o.MaxRetries || !o.RetryIf(err) {
+			return err
+		}
+		if sleepErr := sleepContext(ctx, b.delay(attempt)); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+func runTransaction(ctx context.Context, db *gorm.DB, txOpts *sql.TxOptions, fn func(tx *gorm.DB) error) (err error) {
+	tx := db.BeginTx(ctx, txOpts)
+	if tx.Error != nil {
+		return fmt.Errorf("beginning transaction: %w", tx.Error)
+	}
+
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		if p := recover(); p != nil {
+			if rbErr := tx.Rollback().Error; rbErr != nil {
+				panic(&TxPanicError{Value: p, RollbackError: rbErr})
+			}
+			panic(p)
+		}
+		if rbErr := tx.Rollback().Error; rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			err = fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+func withSavepoint(tx *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	name := fmt.Sprintf("sp_%d", atomic.AddUint64(&savepointID, 1))
+	if err := tx.Exec("SAVEPOINT " + name).Error; err != nil {
+		return fmt.Errorf("creating savepoint: %w", err)
+	}
+
+	released := false
+	defer func() {
+		if released {
+			return
+		}
+		rbErr := tx.Exec("ROLLBACK TO SAVEPOINT " + name).Error
+		if p := recover(); p != nil {
+			if rbErr != nil {
+				panic(&TxPanicError{Value: p, RollbackError: rbErr})
+			}
+			panic(p)
+		}
+		if rbErr != nil {
+			err = fmt.Errorf("%w (rollback to savepoint failed: %v)", err, rbErr)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Exec("RELEASE SAVEPOINT " + name).Error; err != nil {
+		return fmt.Errorf("releasing savepoint: %w", err)
+	}
+	released = true
+	return nil
+}
@@ -0,0 +1,501 @@
+package goutils
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWebhookSignature = errors.New("webhook signature mismatch")
+	ErrWebhookTimestamp = errors.New("webhook timestamp outside tolerance")
+	ErrWebhookMalformed = errors.New("malformed webhook")
+)
+
+// WebhookVerifier checks the signature of a webhook delivery. It returns the
+// timestamp covered by the signature, or the zero time if the scheme has none.
+type WebhookVerifier interface {
+	Verify(header http.Header, body []byte) (time.Time, error)
+}
+
+type SignatureEncoding int
+
+const (
+	HexEncoding SignatureEncoding = iota
+	Base64Encoding
+)
+
+// HMACVerifier verifies signatures of the form <Prefix><encoded HMAC> carried in
+// Header. When TimestampHeader is set the signed payload is "<timestamp>.<body>"
+// and the timestamp is parsed as Unix seconds.
+type HMACVerifier struct {
+	// Secrets holds every accepted secret, allowing rotation without downtime.
+	Secrets         [][]byte
+	Header          string
+	Prefix          string
+	Hash            func() hash.Hash
+	Encoding        SignatureEncoding
+	TimestampHeader string
+}
+
+// NewGitHubVerifier verifies X-Hub-Signature-256 headers as sent by GitHub.
+func NewGitHubVerifier(secrets ...string) *HMACVerifier {
+	return &HMACVerifier{
+		Secrets: toSecrets(secrets),
+		Header:  "X-Hub-Signature-256",
+		Prefix:  "sha256=",
+	}
+}
+
+func (v *HMACVerifier) Verify(header http.Header, body []byte) (time.Time, error) {
+	signature := header.Get(v.Header)
+	if signature == "" || !strings.HasPrefix(signature, v.Prefix) {
+		return time.Time{}, fmt.Errorf("%w: missing %s header", ErrWebhookSignature, v.Header)
+	}
+	expected, err := decodeSignature(strings.TrimPrefix(signature, v.Prefix), v.Encoding)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrWebhookMalformed, err)
+	}
+
+	var timestamp time.Time
+	payload := body
+	if v.TimestampHeader != "" {
+		raw := header.Get(v.TimestampHeader)
+		if timestamp, err = parseUnixTimestamp(raw); err != nil {
+			return time.Time{}, fmt.Errorf("%w: %s header: %v", ErrWebhookMalformed, v.TimestampHeader, err)
+		}
+		payload = signedPayload(raw, body)
+	}
+
+	hashFn := v.Hash
+	if hashFn == nil {
+		hashFn = sha256.New
+	}
+	for _, secret := range v.Secrets {
+		if hmac.Equal(computeHMAC(hashFn, secret, payload), expected) {
+			return timestamp, nil
+		}
+	}
+	return time.Time{}, ErrWebhookSignature
+}
+
+// StripeVerifier verifies Stripe-Signature headers ("t=<ts>,v1=<hex>[,v1=...]").
+type StripeVerifier struct {
+	Secrets [][]byte
+	Header  string
+}
+
+func NewStripeVerifier(secrets ...string) *StripeVerifier {
+	return &StripeVerifier{Secrets: toSecrets(secrets), Header: "Stripe-Signature"}
+}
+
+func (v *StripeVerifier) Verify(header http.Header, body []byte) (time.Time, error) {
+	value := header.Get(v.Header)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%w: missing %s header", ErrWebhookSignature, v.Header)
+	}
+
+	var (
+		rawTimestamp string
+		signatures   [][]byte
+	)
+	for _, part := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			rawTimestamp = val
+		case "v1":
+			if sig, err := hex.DecodeString(val); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	timestamp, err := parseUnixTimestamp(rawTimestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrWebhookMalformed, err)
+	}
+	if len(signatures) == 0 {
+		return time.Time{}, fmt.Errorf("%w: no v1 signature", ErrWebhookSignature)
+	}
+
+	payload := signedPayload(rawTimestamp, body)
+	for _, secret := range v.Secrets {
+		mac := computeHMAC(sha256.New, secret, payload)
+		for _, sig := range signatures {
+			if hmac.Equal(mac, sig) {
+				return timestamp, nil
+			}
+		}
+	}
+	return time.Time{}, ErrWebhookSignature
+}
+
+func toSecrets(secrets []string) [][]byte {
+	out := make([][]byte, len(secrets))
+	for i, s := range secrets {
+		out[i] = []byte(s)
+	}
+	return out
+}
+
+func computeHMAC(hashFn func() hash.Hash, secret, payload []byte) []byte {
+	mac := hmac.New(hashFn, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func decodeSignature(s string, encoding SignatureEncoding) ([]byte, error) {
+	if encoding == Base64Encoding {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return hex.DecodeString(s)
+}
+
+func signedPayload(timestamp string, body []byte) []byte {
+	payload := make([]byte, 0, len(timestamp)+1+len(body))
+	payload = append(payload, timestamp...)
+	payload = append(payload, '.')
+	return append(payload, body...)
+}
+
+func parseUnixTimestamp(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, errors.New("missing timestamp")
+	}
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// DeliveryStore remembers processed delivery IDs to reject replays.
+type DeliveryStore interface {
+	// Claim records id for ttl and reports false if it is already recorded.
+	Claim(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	// Release forgets id so that a failed delivery can be retried.
+	Release(ctx context.Context, id string) error
+}
+
+// MemoryDeliveryStore is a process-local DeliveryStore. Use a shared store
+// (e.g. backed by Redis or a database) when running several replicas.
+type MemoryDeliveryStore struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	// expiries orders the claims by expiry, so that expired IDs are dropped
+	// without scanning seen.
+	expiries deliveryExpiries
+}
+
+func NewMemoryDeliveryStore() *MemoryDeliveryStore {
+	return &MemoryDeliveryStore{seen: make(map[string]time.Time)}
+}
+
+func (s *MemoryDeliveryStore) Claim(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for len(s.expiries) > 0 && now.After(s.expiries[0].expiry) {
+		oldest := heap.Pop(&s.expiries).(deliveryExpiry)
+		// Released or claimed again since.
+		if expiry, ok := s.seen[oldest.id]; ok && expiry.Equal(oldest.expiry) {
+			delete(s.seen, oldest.id)
+		}
+	}
+	if expiry, ok := s.seen[id]; ok && !now.After(expiry) {
+		return false, nil
+	}
+	expiry := now.Add(ttl)
+	s.seen[id] = expiry
+	heap.Push(&s.expiries, deliveryExpiry{id: id, expiry: expiry})
+	return true, nil
+}
+
+func (s *MemoryDeliveryStore) Release(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.seen, id)
+	return nil
+}
+
+type deliveryExpiry struct {
+	id     string
+	expiry time.Time
+}
+
+// deliveryExpiries is a min-heap of claims by expiry.
+type deliveryExpiries []deliveryExpiry
+
+func (h deliveryExpiries) Len() int           { return len(h) }
+func (h deliveryExpiries) Less(i, j int) bool { return h[i].expiry.Before(h[j].expiry) }
+func (h deliveryExpiries) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *deliveryExpiries) Push(x any)        { *h = append(*h, x.(deliveryExpiry)) }
+func (h *deliveryExpiries) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// WebhookConfig configures a WebhookReceiver. Delivery IDs and event types are
+// read from the given header, or else from the given (dotted) JSON field.
+type WebhookConfig struct {
+	Verifier WebhookVerifier
+	// Tolerance bounds the age of signed timestamps. Defaults to 5 minutes.
+	Tolerance time.Duration
+	// Store deduplicates deliveries when set.
+	Store DeliveryStore
+	// DeliveryTTL is how long delivery IDs are remembered. Defaults to 24 hours.
+	DeliveryTTL      time.Duration
+	DeliveryIDHeader string
+	DeliveryIDField  string
+	EventTypeHeader  string
+	EventTypeField   string
+	// MaxBodyBytes limits the accepted payload size. Defaults to 1 MiB.
+	MaxBodyBytes int64
+	Logger       *Logger
+}
+
+// GitHubWebhookConfig returns a configuration for GitHub webhooks.
+func GitHubWebhookConfig(secrets ...string) WebhookConfig {
+	return WebhookConfig{
+		Verifier:         NewGitHubVerifier(secrets...),
+		Store:            NewMemoryDeliveryStore(),
+		DeliveryIDHeader: "X-GitHub-Delivery",
+		EventTypeHeader:  "X-GitHub-Event",
+	}
+}
+
+// StripeWebhookConfig returns a configuration for Stripe webhooks.
+func StripeWebhookConfig(secrets ...string) WebhookConfig {
+	return WebhookConfig{
+		Verifier:        NewStripeVerifier(secrets...),
+		Store:           NewMemoryDeliveryStore(),
+		DeliveryIDField: "id",
+		EventTypeField:  "type",
+	}
+}
+
+type WebhookEvent struct {
+	ID        string
+	Type      string
+	Timestamp time.Time
+	Header    http.Header
+	Body      []byte
+}
+
+type WebhookHandlerFunc func(ctx context.Context, event *WebhookEvent) error
+
+// WebhookReceiver is an http.Handler that verifies, deduplicates and dispatches
+// webhook deliveries to the handlers registered for their event type.
+type WebhookReceiver struct {
+	config   WebhookConfig
+	mu       sync.RWMutex
+	handlers map[string]WebhookHandlerFunc
+}
+
+func NewWebhookReceiver(config WebhookConfig) (*WebhookReceiver, error) {
+	if config.Verifier == nil {
+		return nil, errors.New("webhook verifier is required")
+	}
+	if err := checkWebhookSecrets(config.Verifier); err != nil {
+		return nil, err
+	}
+	if config.Tolerance <= 0 {
+		config.Tolerance = 5 * time.Minute
+	}
+	if config.DeliveryTTL <= 0 {
+		config.DeliveryTTL = 24 * time.Hour
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = 1 << 20
+	}
+	if config.Logger == nil {
+		config.Logger = NewLogger()
+	}
+	return &WebhookReceiver{config: config, handlers: make(map[string]WebhookHandlerFunc)}, nil
+}
+
+// checkWebhookSecrets rejects the built-in verifiers without secrets, which
+// would reject every delivery.
+func checkWebhookSecrets(verifier WebhookVerifier) error {
+	var secrets [][]byte
+	switch v := verifier.(type) {
+	case *HMACVerifier:
+		secrets = v.Secrets
+	case *StripeVerifier:
+		secrets = v.Secrets
+	default:
+		return nil
+	}
+	if len(secrets) == 0 {
+		return errors.New("webhook verifier has no secret")
+	}
+	for _, secret := range secrets {
+		if len(secret) == 0 {
+			return errors.New("webhook verifier has an empty secret")
+		}
+	}
+	return nil
+}
+
+// Handle registers fn for eventType. The "*" event type receives events that
+// have no dedicated handler.
+func (r *WebhookReceiver) Handle(eventType string, fn WebhookHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[eventType] = fn
+}
+
+// HandleWebhook registers a handler that receives the payload decoded into T.
+func HandleWebhook[T any](r *WebhookReceiver, eventType string, fn func(ctx context.Context, event *WebhookEvent, payload T) error) {
+	r.Handle(eventType, func(ctx context.Context, event *WebhookEvent) error {
+		var payload T
+		if err := json.Unmarshal(event.Body, &payload); err != nil {
+			return fmt.Errorf("%w: decode %s payload: %v", ErrWebhookMalformed, eventType, err)
+		}
+		return fn(ctx, event, payload)
+	})
+}
+
+func (r *WebhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, r.config.MaxBodyBytes))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	event, err := r.parse(req.Header, body)
+	if err != nil {
+		// The details are logged but not returned to the sender.
+		r.config.Logger.WithError(err).Warn("rejected webhook")
+		if errors.Is(err, ErrWebhookSignature) || errors.Is(err, ErrWebhookTimestamp) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		} else {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		}
+		return
+	}
+	logger := r.config.Logger.WithField("event_type", event.Type).WithField("delivery_id", event.ID)
+
+	handler := r.handler(event.Type)
+	if handler == nil {
+		logger.Debug("ignoring webhook without handler")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	ctx := req.Context()
+	if r.config.Store != nil && event.ID != "" {
+		claimed, err := r.config.Store.Claim(ctx, event.ID, r.config.DeliveryTTL)
+		if err != nil {
+			logger.WithError(err).Error("failed to record webhook delivery")
+			http.Error(w, "delivery store unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if !claimed {
+			logger.Info("ignoring duplicate webhook delivery")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	if err := handler(ctx, event); err != nil {
+		logger.WithError(err).Error("webhook handler failed")
+		if r.config.Store != nil && event.ID != "" {
+			if err := r.config.Store.Release(ctx, event.ID); err != nil {
+				logger.WithError(err).Error("failed to release webhook delivery")
+			}
+		}
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrWebhookMalformed) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, "webhook handler failed", status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *WebhookReceiver) parse(header http.Header, body []byte) (*WebhookEvent, error) {
+	timestamp, err := r.config.Verifier.Verify(header, body)
+	if err != nil {
+		return nil, err
+	}
+	if !timestamp.IsZero() {
+		if age := time.Since(timestamp); age > r.config.Tolerance || age < -r.config.Tolerance {
+			return nil, fmt.Errorf("%w: %s old", ErrWebhookTimestamp, age.Round(time.Second))
+		}
+	}
+
+	event := &WebhookEvent{Timestamp: timestamp, Header: header, Body: body}
+	var fields map[string]any
+	if r.config.DeliveryIDField != "" || r.config.EventTypeField != "" {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&fields); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWebhookMalformed, err)
+		}
+	}
+	event.ID = webhookValue(header, r.config.DeliveryIDHeader, fields, r.config.DeliveryIDField)
+	event.Type = webhookValue(header, r.config.EventTypeHeader, fields, r.config.EventTypeField)
+	return event, nil
+}
+
+func (r *WebhookReceiver) handler(eventType string) WebhookHandlerFunc {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if fn, ok := r.handlers[eventType]; ok {
+		return fn
+	}
+	return r.handlers["*"]
+}
+
+func webhookValue(header http.Header, headerName string, fields map[string]any, field string) string {
+	if headerName != "" {
+		if v := header.Get(headerName); v != "" {
+			return v
+		}
+	}
+	if field == "" {
+		return ""
+	}
+	var current any = fields
+	for _, key := range strings.Split(field, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return ""
+		}
+		current = m[key]
+	}
+	switch v := current.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}